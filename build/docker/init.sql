@@ -1,11 +1,35 @@
 create table if not exists chats (
     id BIGINT PRIMARY KEY,
-    name varchar(100) NOT NULL
+    name varchar(100) NOT NULL,
+    -- set with /timezone, overrides the Todoist profile timezone
+    timezone VARCHAR(64),
+    -- set with /writeback: 'off', 'comment' or 'duration'
+    writeback VARCHAR(16) NOT NULL DEFAULT 'off'
 );
 
 create table if not exists todoist_users (
     id VARCHAR(100) PRIMARY KEY,
-    name VARCHAR(100) NOT NULL
+    name VARCHAR(100) NOT NULL,
+    -- first day of the week as in Todoist: 1 is Monday, 7 is Sunday
+    start_day INT NOT NULL DEFAULT 1,
+    timezone VARCHAR(64),
+    -- Todoist sync_token of the last incremental sync, NULL before the first one
+    sync_token VARCHAR(200)
+);
+
+-- token is the OAuth access token encrypted with TOKEN_ENCRYPTION_KEY
+create table if not exists todoist_tokens (
+    todoist_id VARCHAR(100) PRIMARY KEY,
+    token BYTEA NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    FOREIGN KEY (todoist_id) REFERENCES todoist_users(id)
+);
+
+-- OAuth states of started /auth flows, consumed by the callback
+create table if not exists oauth_states (
+    state VARCHAR(100) PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
 );
 
 create table if not exists stat (
@@ -15,25 +39,110 @@ create table if not exists stat (
 );
 
 create table if not exists tasks (
+    id BIGSERIAL PRIMARY KEY,
     chat_id BIGINT NOT NULL,
+    task_id VARCHAR(100),
     content varchar(1000) not null,
     time_spent INT not null,
+    event_key VARCHAR(300) UNIQUE,
+    project_id VARCHAR(100),
+    section_id VARCHAR(100),
+    labels TEXT[] NOT NULL DEFAULT '{}',
+    priority INT,
+    completed_at TIMESTAMPTZ,
+    tracked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- set when the task was uncompleted; the entry stays to keep reverts idempotent
+    reverted BOOLEAN NOT NULL DEFAULT false,
     FOREIGN KEY (chat_id) REFERENCES chats(id)
 );
 
+create index if not exists tasks_task_id_idx ON tasks (chat_id, task_id);
+create index if not exists tasks_tracked_at_idx ON tasks (chat_id, tracked_at);
+
+-- the running timer of a chat, started with /timer; task_id is NULL for tasks not in Todoist
+create table if not exists timers (
+    chat_id BIGINT PRIMARY KEY,
+    task_id VARCHAR(100),
+    content VARCHAR(1000) NOT NULL,
+    project_id VARCHAR(100),
+    section_id VARCHAR(100),
+    labels TEXT[] NOT NULL DEFAULT '{}',
+    priority INT,
+    started_at TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (chat_id) REFERENCES chats(id)
+);
+
+create table if not exists projects (
+    id VARCHAR(100) PRIMARY KEY,
+    todoist_id VARCHAR(100) NOT NULL,
+    name VARCHAR(200) NOT NULL,
+    FOREIGN KEY (todoist_id) REFERENCES todoist_users(id)
+);
+
 create table if not exists chat_to_todoist (
     chat_id BIGINT NOT NUll,
     todoist_id VARCHAR(100) NOT NULL,
     FOREIGN KEY (chat_id) REFERENCES chats(id),
-    FOREIGN KEY (todoist_id) REFERENCES todoist_users(id)
+    FOREIGN KEY (todoist_id) REFERENCES todoist_users(id),
+    UNIQUE (chat_id, todoist_id)
 );
 
-CREATE PROCEDURE RecordStats(IN chatID BIGINT, IN content VARCHAR(1000), IN timeSpent INT)
+-- RecordStats returns false when an entry with the same event key was already recorded.
+CREATE FUNCTION RecordStats(
+    chatID BIGINT, taskID VARCHAR(100), content VARCHAR(1000), timeSpent INT, eventKey VARCHAR(300),
+    projectID VARCHAR(100), sectionID VARCHAR(100), taskLabels TEXT[], taskPriority INT, completedAt TIMESTAMPTZ
+)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    PERFORM time_count FROM stat WHERE chat_id = chatID FOR UPDATE;
+    INSERT INTO tasks (chat_id, task_id, content, time_spent, event_key, project_id, section_id, labels, priority, completed_at, tracked_at)
+    VALUES (chatID, taskID, content, timeSpent, eventKey, projectID, sectionID, COALESCE(taskLabels, '{}'), taskPriority, completedAt, COALESCE(completedAt, now()))
+    ON CONFLICT (event_key) DO NOTHING;
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+    INSERT INTO stat (chat_id, time_count) VALUES (chatID, timeSpent) ON CONFLICT (chat_id) DO UPDATE SET time_count = stat.time_count + timeSpent;
+    RETURN true;
+END;
+$$;
+
+-- RevertStats marks the entry of the task's latest completion as reverted and takes its
+-- time out of the stats. Both outputs are NULL when the task has no completion or its
+-- latest one is already reverted, so repeating a revert changes nothing.
+CREATE FUNCTION RevertStats(chatID BIGINT, taskID VARCHAR(100), OUT revertedContent VARCHAR(1000), OUT revertedTime INT)
 LANGUAGE plpgsql
 AS $$
+DECLARE
+    latestID BIGINT;
+    latestReverted BOOLEAN;
 BEGIN
     PERFORM time_count FROM stat WHERE chat_id = chatID FOR UPDATE;
-    INSERT INTO tasks (chat_id, content, time_spent) VALUES (chatID, content, timeSpent);
-    INSERT INTO stat (chat_id) VALUES (chatID) ON CONFLICT (chat_id) DO UPDATE SET time_count = stat.time_count + timeSpent;
+    SELECT id, reverted INTO latestID, latestReverted FROM tasks
+    WHERE chat_id = chatID AND task_id = taskID AND completed_at IS NOT NULL
+    ORDER BY completed_at DESC, id DESC LIMIT 1
+    FOR UPDATE;
+    IF NOT FOUND OR latestReverted THEN
+        RETURN;
+    END IF;
+    UPDATE tasks SET reverted = true WHERE id = latestID
+    RETURNING content, time_spent INTO revertedContent, revertedTime;
+    UPDATE stat SET time_count = time_count - revertedTime WHERE chat_id = chatID;
 END;
-$$;
\ No newline at end of file
+$$;
+
+create table if not exists webhook_inbox (
+    id BIGSERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    delivery_id VARCHAR(100) UNIQUE,
+    event_key VARCHAR(300) UNIQUE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    processed_at TIMESTAMPTZ
+);
+
+create index if not exists webhook_inbox_pending_idx ON webhook_inbox (next_attempt_at) WHERE status = 'pending';
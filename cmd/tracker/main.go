@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/base64"
 	"log"
 	"os"
 	"os/signal"
 	"sync"
+	"time"
 
 	config "example.com/bot/configs"
 	tgbot "example.com/bot/internal/bot"
@@ -13,10 +15,16 @@ import (
 	"example.com/bot/internal/models"
 	"example.com/bot/internal/repository"
 	handler "example.com/bot/internal/service/todoist"
+	"example.com/bot/pkg/authlink"
+	"example.com/bot/pkg/secretbox"
+	"example.com/bot/pkg/todoist"
 
 	"go.uber.org/zap"
 )
 
+// authLinkTTL is how long a link sent by /auth can be opened.
+const authLinkTTL = 15 * time.Minute
+
 func dbh(f string, args ...any) {
 	log.Printf(f, args...)
 }
@@ -28,7 +36,7 @@ func main() {
 		panic(err)
 	}
 	logger.Log.Debug("fnish config creating",
-		zap.Any("config", cfg),
+		zap.Stringer("config", cfg),
 	)
 	logger.Log.Debug("Process",
 		zap.Int("PID:", os.Getpid()),
@@ -40,14 +48,42 @@ func main() {
 	r := repository.New(ctx, cfg.DB_HOST, cfg.DB_PORT, cfg.DB_NAME, cfg.DB_USER, cfg.DB_PASSWORD)
 	storage := repository.NewLocalStorage()
 
+	key, err := base64.StdEncoding.DecodeString(cfg.TOKEN_ENCRYPTION_KEY)
+	if err != nil {
+		panic(err)
+	}
+	box, err := secretbox.New(key)
+	if err != nil {
+		panic(err)
+	}
+	tokens := repository.NewTokenStore(r, box)
+
 	ch := make(chan models.WebHookParsed)
 	authNotificatioins := make(chan models.AuthNotification)
 
-	ah := handler.NewAuthHandler(cfg.APP_CLIENT_ID, cfg.APP_CLIENT_SECRET, authNotificatioins, r, storage)
-	wh := handler.NewWebHookHandler(ch)
+	authLinks := authlink.New([]byte(cfg.AUTH_LINK_SECRET), authLinkTTL)
+
+	client := todoist.New(todoist.Config{
+		ClientID:     cfg.APP_CLIENT_ID,
+		ClientSecret: cfg.APP_CLIENT_SECRET,
+		TokenURL:     cfg.TODOIST_TOKEN_URL,
+		APIURL:       cfg.TODOIST_API_URL,
+	})
+
+	ah := handler.NewAuthHandler(cfg.APP_CLIENT_ID, cfg.TODOIST_AUTH_URL, client, cfg.BOT_USERNAME, authNotificatioins, r, tokens, authLinks)
+	writer := handler.NewTimeWriter(r, tokens, client)
+	timers := handler.NewTimers(r, writer)
+	wh := handler.NewWebHookHandler(ch, cfg.APP_CLIENT_SECRET, r, writer, timers)
 	srv := handler.NewService(ah, wh)
 
-	tgBotHandlers := tgbot.NewTgHandlers(r, storage)
+	projects := handler.NewProjectResolver(r, tokens, client)
+	profiles := handler.NewProfileRefresher(r, tokens, client)
+	syncer := handler.NewSyncWorker(r, tokens, client, wh)
+	poller := handler.NewPoller(r, tokens, client, wh)
+	tasks := handler.NewTaskManager(r, tokens, client, wh)
+	wh.Router().Register("item:updated", handler.NewDoingLabel(cfg.TODOIST_DOING_LABEL, wh, timers, tasks))
+
+	tgBotHandlers := tgbot.NewTgHandlers(r, storage, projects, ah, authLinks, cfg.PUBLIC_BASE_URL, writer, tasks, timers, handler.InternalLabels(cfg.TODOIST_DOING_LABEL))
 	b, err := tgbot.New(cfg.TELEGRAM_APITOKEN, dbh, tgBotHandlers, authNotificatioins, ch)
 	if err != nil {
 		panic(err)
@@ -56,7 +92,13 @@ func main() {
 	wg := &sync.WaitGroup{}
 
 	srv.Start(wg, ctx)
+	profiles.Start(wg, ctx)
+	syncer.Start(wg, ctx)
+	if cfg.TODOIST_EVENT_SOURCE == config.EventSourcePoll {
+		poller.Start(wg, ctx)
+	}
 	b.Start(wg, ctx)
 
 	wg.Wait()
+	writer.Wait()
 }
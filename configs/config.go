@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -20,8 +21,36 @@ type Config struct {
 	TELEGRAM_APITOKEN string
 	APP_CLIENT_ID     string
 	APP_CLIENT_SECRET string
+	// base64 encoded 32 byte key for the stored Todoist tokens
+	TOKEN_ENCRYPTION_KEY string
+	// secret for signing the chat ID in /auth links
+	AUTH_LINK_SECRET string
+	// Todoist endpoints, overridable for staging or a fake Todoist server
+	TODOIST_AUTH_URL  string
+	TODOIST_TOKEN_URL string
+	TODOIST_API_URL   string
+	// address the service is reachable at, used in the links sent by the bot
+	PUBLIC_BASE_URL string
+	BOT_USERNAME    string
+	// how completions are received: "webhook", or "poll" where Todoist cannot
+	// reach the service
+	TODOIST_EVENT_SOURCE string
+	// label that runs a timer for the task while it is set in Todoist; it needs
+	// item:updated webhooks, so it does nothing when TODOIST_EVENT_SOURCE is "poll"
+	TODOIST_DOING_LABEL string
 }
 
+const (
+	defaultTodoistAuthURL  = "https://todoist.com/oauth/authorize"
+	defaultTodoistTokenURL = "https://todoist.com/oauth/access_token"
+	defaultTodoistAPIURL   = "https://api.todoist.com/api/v1"
+
+	EventSourceWebhook = "webhook"
+	EventSourcePoll    = "poll"
+
+	defaultDoingLabel = "doing"
+)
+
 // TODO how to fix it to work from any dir
 func LoadConfig() (*Config, error) {
 	currentDir, err := os.Getwd()
@@ -36,23 +65,67 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 	cfg := &Config{
-		DB_HOST:           os.Getenv("DB_HOST"),
-		DB_PORT:           os.Getenv("DB_PORT"),
-		DB_NAME:           os.Getenv("DB_NAME"),
-		DB_USER:           os.Getenv("DB_USER"),
-		DB_PASSWORD:       os.Getenv("DB_PASS"),
-		TELEGRAM_APITOKEN: os.Getenv("TELEGRAM_APITOKEN"),
-		APP_CLIENT_ID:     os.Getenv("TODOIST_CLIENT_ID"),
-		APP_CLIENT_SECRET: os.Getenv("TODOIST_CLIENT_SECRET"),
+		DB_HOST:              os.Getenv("DB_HOST"),
+		DB_PORT:              os.Getenv("DB_PORT"),
+		DB_NAME:              os.Getenv("DB_NAME"),
+		DB_USER:              os.Getenv("DB_USER"),
+		DB_PASSWORD:          os.Getenv("DB_PASS"),
+		TELEGRAM_APITOKEN:    os.Getenv("TELEGRAM_APITOKEN"),
+		APP_CLIENT_ID:        os.Getenv("TODOIST_CLIENT_ID"),
+		APP_CLIENT_SECRET:    os.Getenv("TODOIST_CLIENT_SECRET"),
+		TOKEN_ENCRYPTION_KEY: os.Getenv("TOKEN_ENCRYPTION_KEY"),
+		AUTH_LINK_SECRET:     os.Getenv("AUTH_LINK_SECRET"),
+		TODOIST_AUTH_URL:     getEnv("TODOIST_AUTH_URL", defaultTodoistAuthURL),
+		TODOIST_TOKEN_URL:    getEnv("TODOIST_TOKEN_URL", defaultTodoistTokenURL),
+		TODOIST_API_URL:      strings.TrimSuffix(getEnv("TODOIST_API_URL", defaultTodoistAPIURL), "/"),
+		PUBLIC_BASE_URL:      strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/"),
+		BOT_USERNAME:         strings.TrimPrefix(os.Getenv("BOT_USERNAME"), "@"),
+		TODOIST_EVENT_SOURCE: getEnv("TODOIST_EVENT_SOURCE", EventSourceWebhook),
+		TODOIST_DOING_LABEL:  strings.TrimPrefix(getEnv("TODOIST_DOING_LABEL", defaultDoingLabel), "@"),
 	}
 	err = validateStruct(*cfg)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("%v\n", cfg)
+	if cfg.TODOIST_EVENT_SOURCE != EventSourceWebhook && cfg.TODOIST_EVENT_SOURCE != EventSourcePoll {
+		return nil, fmt.Errorf("TODOIST_EVENT_SOURCE must be %q or %q, got %q", EventSourceWebhook, EventSourcePoll, cfg.TODOIST_EVENT_SOURCE)
+	}
 	return cfg, nil
 }
 
+// secretFields are hidden when the config is printed.
+var secretFields = map[string]bool{
+	"DB_PASSWORD":          true,
+	"TELEGRAM_APITOKEN":    true,
+	"APP_CLIENT_SECRET":    true,
+	"TOKEN_ENCRYPTION_KEY": true,
+	"AUTH_LINK_SECRET":     true,
+}
+
+// String lists the config fields with the secrets hidden, so the config can be logged.
+func (c Config) String() string {
+	structType := reflect.TypeOf(c)
+	structVal := reflect.ValueOf(c)
+	fields := make([]string, 0, structType.NumField())
+	for i := range structType.NumField() {
+		name := structType.Field(i).Name
+		val := structVal.Field(i).String()
+		if secretFields[name] && val != "" {
+			val = "***"
+		}
+		fields = append(fields, name+"="+val)
+	}
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+// getEnv returns the environment variable key, or def if it is not set.
+func getEnv(key, def string) string {
+	if val := os.Getenv(key); val != "" {
+		return val
+	}
+	return def
+}
+
 // TODO work with errrors
 // TODO delete get from
 // get from here - https://medium.com/@anajankow/fast-check-if-all-struct-fields-are-set-in-golang-bba1917213d2
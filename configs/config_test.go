@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigString(t *testing.T) {
+	cfg := &Config{
+		DB_HOST:              "db",
+		DB_PASSWORD:          "db-pass",
+		TELEGRAM_APITOKEN:    "bot-token",
+		APP_CLIENT_SECRET:    "client-secret",
+		TOKEN_ENCRYPTION_KEY: "encryption-key",
+		AUTH_LINK_SECRET:     "link-secret",
+	}
+	printed := fmt.Sprintf("%v", cfg)
+	assert.Contains(t, printed, "DB_HOST=db")
+	assert.Contains(t, printed, "TOKEN_ENCRYPTION_KEY=***")
+	for _, secret := range []string{"db-pass", "bot-token", "client-secret", "encryption-key", "link-secret"} {
+		assert.NotContains(t, printed, secret)
+	}
+}
@@ -3,11 +3,14 @@ package tgbot
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"sync"
 
 	"example.com/bot/internal/logger"
 	"example.com/bot/internal/models"
+	"example.com/bot/pkg/duration"
 	"github.com/go-telegram/bot"
+	"go.uber.org/zap"
 )
 
 type TelegramBotApi struct {
@@ -32,8 +35,19 @@ func New(TelegramTokenAPI string, debugHandler bot.DebugHandler, handlers *Teleg
 
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypeExact, handlers.startHandler)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/help", bot.MatchTypeExact, handlers.helpHandler)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/stats", bot.MatchTypeExact, handlers.statsHandler)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/stats(\s|$)`), handlers.statsHandler)
 	b.RegisterHandler(bot.HandlerTypeMessageText, "/auth", bot.MatchTypeExact, handlers.authHandler)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/logout", bot.MatchTypeExact, handlers.logoutHandler)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/timezone(\s|$)`), handlers.timezoneHandler)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/writeback(\s|$)`), handlers.writeBackHandler)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/add(\s|$)`), handlers.addHandler)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/today", bot.MatchTypeExact, handlers.todayHandler)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, todayCallbackPrefix, bot.MatchTypePrefix, handlers.todayCallback)
+	b.RegisterHandlerRegexp(bot.HandlerTypeMessageText, regexp.MustCompile(`^/timer(\s|$)`), handlers.timerHandler)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, timerCallbackPrefix, bot.MatchTypePrefix, handlers.timerCallback)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/stop", bot.MatchTypeExact, handlers.stopHandler)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/status", bot.MatchTypeExact, handlers.statusHandler)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, timeCallbackPrefix, bot.MatchTypePrefix, handlers.timeCallback)
 
 	return &TelegramBotApi{b: b,
 		h:                 handlers,
@@ -66,6 +80,12 @@ func (b *TelegramBotApi) Start(wg *sync.WaitGroup, ctx context.Context) {
 						ChatID: notification.ChatID,
 						Text:   "Todoist authentication completed successfully!",
 					})
+				} else if notification.LinkedElsewhere {
+					b.b.SendMessage(ctx, &bot.SendMessageParams{
+						ChatID: notification.ChatID,
+						Text:   "This Todoist account is already linked to another chat. Use /logout there first",
+					})
+					b.h.storage.SetStatus(notification.ChatID, noActionState)
 				} else {
 					b.b.SendMessage(ctx, &bot.SendMessageParams{
 						ChatID: notification.ChatID,
@@ -93,20 +113,48 @@ func (b *TelegramBotApi) AskToTrackTime(wg *sync.WaitGroup, ctx context.Context)
 				return
 			case val := <-b.wh:
 				logger.Log.Debug("get webhook")
-				chatID := b.h.r.GetChatIDByTodoist(ctx, val.UserID)
+				if val.Reverted {
+					b.b.SendMessage(ctx, &bot.SendMessageParams{
+						ChatID: val.ChatID,
+						Text:   fmt.Sprintf("Task: %s was uncompleted, removed %s from stats", val.Task, duration.Format(val.TimeSpent)),
+					})
+					continue
+				}
+				if val.TimerStarted {
+					b.b.SendMessage(ctx, &bot.SendMessageParams{
+						ChatID: val.ChatID,
+						Text:   fmt.Sprintf("Timer started for %s", val.Task),
+					})
+					continue
+				}
+				if val.TimerStopped {
+					b.b.SendMessage(ctx, &bot.SendMessageParams{
+						ChatID: val.ChatID,
+						Text:   fmt.Sprintf("Timer stopped, stored %s for task: %s", duration.Format(val.TimeSpent), val.Task),
+					})
+					continue
+				}
 				if !val.AskTime {
+					// already stored by the webhook worker
 					b.b.SendMessage(ctx, &bot.SendMessageParams{
-						ChatID: chatID,
-						Text:   fmt.Sprintf("Stored %d for task: %s", val.TimeSpent, val.Task),
+						ChatID: val.ChatID,
+						Text:   fmt.Sprintf("Stored %s for task: %s", duration.Format(val.TimeSpent), val.Task),
 					})
-					b.h.r.StoreTaskTracked(ctx, chatID, val)
 					continue
 				}
-				msg, _ := b.b.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: chatID,
-					Text:   fmt.Sprintf("Enter time for this task in reply message: %s", val.Task),
+				msg, err := b.b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:      val.ChatID,
+					Text:        fmt.Sprintf("Pick the time for this task or enter it in reply message (e.g. 1h30m, 45m, 1:15): %s", val.Task),
+					ReplyMarkup: timePromptKeyboard(),
 				})
-				b.h.mes.Store(msg.ID, val)
+				if err != nil {
+					logger.Log.Error("Error asking time to track",
+						zap.Int64("chat_id", val.ChatID),
+						zap.Error(err),
+					)
+					continue
+				}
+				b.h.mes.Store(promptKey{chatID: val.ChatID, messageID: msg.ID}, val)
 			}
 		}
 	}()
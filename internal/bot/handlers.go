@@ -2,21 +2,48 @@ package tgbot
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"example.com/bot/internal/logger"
 	"example.com/bot/internal/models"
 	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/authlink"
+	"example.com/bot/pkg/duration"
 	"github.com/go-telegram/bot"
 	m "github.com/go-telegram/bot/models"
 	"go.uber.org/zap"
 )
 
 const (
-	pattern       = `^(?P<hours_10>\d+)(?P<hours_1>\d+)(?P<mins_10>\d+)(?P<mins_1>\d+)`
+	statsUsage     = "Use /stats [project|label|priority] [today|week|month|YYYY-MM-DD..YYYY-MM-DD]"
+	writeBackUsage = "/writeback off|comment|duration"
+	addUsage       = "Use /add <task>, e.g. /add Call Alice tomorrow 5pm #Work @calls p2"
+	taskURL        = "https://app.todoist.com/app/task/"
+
+	// callback data of the /today buttons, followed by the task ID
+	todayCallbackPrefix = "today:"
+	todayDoneCallback   = todayCallbackPrefix + "done:"
+	todayTrackCallback  = todayCallbackPrefix + "track:"
+
+	// callback data of the time prompt buttons, followed by minutes, custom or skip
+	timeCallbackPrefix = "time:"
+	timeCustomCallback = timeCallbackPrefix + "custom"
+	timeSkipCallback   = timeCallbackPrefix + "skip"
+
+	// callback data of the /timer task list, followed by the task ID
+	timerCallbackPrefix = "timer:"
+)
+
+// timeQuickPicks are the times offered on the prompt, in minutes.
+var timeQuickPicks = []uint32{15, 30, 45, 60, 120}
+
+const (
 	noActionState = iota
 	todoistRegisteringState
 	waitingForTimeToTrackState
@@ -24,9 +51,63 @@ const (
 
 type TelegramBotHandlers struct {
 	// r       DaoInterface
-	r       *repository.Dao
-	storage *repository.LocalStorage
-	mes     sync.Map
+	r         *repository.Dao
+	tracked   TaskStore
+	storage   *repository.LocalStorage
+	projects  ProjectSyncer
+	accounts  AccountLinker
+	links     *authlink.Signer
+	publicURL string
+	writer    TrackedWriter
+	tasks     TodoistTasks
+	timers    TimerControl
+	// hiddenLabels are left out of /stats by label
+	hiddenLabels []string
+	// mes holds the tasks waiting for their time, by the promptKey of the time prompt
+	mes sync.Map
+}
+
+// promptKey identifies a time prompt. Telegram numbers messages per chat, so the message
+// ID alone is not unique.
+type promptKey struct {
+	chatID    int64
+	messageID int
+}
+
+// TaskStore records the time of tracked tasks.
+type TaskStore interface {
+	StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) (bool, error)
+}
+
+// TrackedWriter is told about every task whose time was stored.
+type TrackedWriter interface {
+	WriteBack(ctx context.Context, wp models.WebHookParsed)
+}
+
+// TodoistTasks works with the tasks of the Todoist account linked to a chat.
+type TodoistTasks interface {
+	QuickAdd(ctx context.Context, chatID int64, text string) (models.Task, models.Project, error)
+	Today(ctx context.Context, chatID int64) ([]models.Task, error)
+	Task(ctx context.Context, chatID int64, taskID string) (models.Task, error)
+	Complete(ctx context.Context, chatID int64, taskID string, track bool) (models.Task, error)
+}
+
+// TimerControl runs the timer of a chat.
+type TimerControl interface {
+	Start(ctx context.Context, chatID int64, timer models.Timer) (models.Timer, bool, error)
+	Status(ctx context.Context, chatID int64) (models.Timer, error)
+	Elapsed(timer models.Timer) uint32
+	Stop(ctx context.Context, chatID int64) (models.WebHookParsed, error)
+}
+
+// AccountLinker undoes the link between a chat and a Todoist account.
+type AccountLinker interface {
+	Logout(ctx context.Context, chatID int64) error
+}
+
+// ProjectSyncer refreshes the project names of the Todoist account linked to a chat.
+type ProjectSyncer interface {
+	SyncProjects(ctx context.Context, chatID int64) error
 }
 
 // type DaoInterface interface {
@@ -36,10 +117,19 @@ type TelegramBotHandlers struct {
 // 	Close()
 // }
 
-func NewTgHandlers(r *repository.Dao, storage *repository.LocalStorage) *TelegramBotHandlers {
+func NewTgHandlers(r *repository.Dao, storage *repository.LocalStorage, projects ProjectSyncer, accounts AccountLinker, links *authlink.Signer, publicURL string, writer TrackedWriter, tasks TodoistTasks, timers TimerControl, hiddenLabels []string) *TelegramBotHandlers {
 	return &TelegramBotHandlers{
-		r:       r,
-		storage: storage,
+		r:            r,
+		tracked:      r,
+		storage:      storage,
+		projects:     projects,
+		accounts:     accounts,
+		links:        links,
+		publicURL:    publicURL,
+		writer:       writer,
+		tasks:        tasks,
+		timers:       timers,
+		hiddenLabels: hiddenLabels,
 	}
 }
 
@@ -59,48 +149,32 @@ func (th *TelegramBotHandlers) defaultHandler(ctx context.Context, b *bot.Bot, u
 			})
 			return
 		}
-		val, ok := th.mes.Load(update.Message.ReplyToMessage.ID)
-		if ok {
+		key := promptKey{chatID: chatID, messageID: update.Message.ReplyToMessage.ID}
+		val, ok := th.mes.Load(key)
+		if ok && val.(models.WebHookParsed).ChatID == chatID {
 			val := val.(models.WebHookParsed)
-			r := regexp.MustCompile(pattern)
-			matches := r.FindStringSubmatch(update.Message.Text)
-			if matches == nil {
+			timeSpent, err := duration.Parse(update.Message.Text)
+			if err != nil {
 				b.SendMessage(ctx, &bot.SendMessageParams{
 					ChatID: chatID,
-					Text:   "Uncorrect time format",
+					Text:   fmt.Sprintf("Uncorrect time format: %v", err),
 				})
 				return
 			}
-			result := make(map[string]uint32)
-			for i, name := range r.SubexpNames() {
-				if i > 0 && name != "" && i < len(matches) {
-					dig, err := strconv.Atoi(matches[i])
-					if err != nil {
-						panic(err)
-					}
-					result[name] = uint32(dig)
-				}
-			}
-			timeSpent := uint32(0)
-			for key, value := range result {
-				switch key {
-				case "hours_10":
-					timeSpent += value * 600
-				case "hours_1":
-					timeSpent += value * 60
-				case "mins_10":
-					timeSpent += value * 10
-				case "mins_1":
-					timeSpent += value
-				}
+			text, done := th.trackTime(ctx, chatID, val, timeSpent)
+			if done {
+				th.mes.Delete(key)
+				// drop the quick picks from the prompt
+				b.EditMessageText(ctx, &bot.EditMessageTextParams{
+					ChatID:    chatID,
+					MessageID: update.Message.ReplyToMessage.ID,
+					Text:      text,
+				})
 			}
-			val.TimeSpent = timeSpent
 			b.SendMessage(ctx, &bot.SendMessageParams{
 				ChatID: chatID,
-				Text:   fmt.Sprintf("Task: %s succesfully tracked: %d", val.Task, val.TimeSpent),
+				Text:   text,
 			})
-			th.r.StoreTaskTracked(ctx, chatID, val)
-			th.mes.Delete(update.Message.ReplyToMessage.ID)
 		}
 	}
 	state := th.storage.GetStatus(chatID)
@@ -151,16 +225,59 @@ func (th *TelegramBotHandlers) startHandler(ctx context.Context, b *bot.Bot, upd
 func (th *TelegramBotHandlers) helpHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   "/auth\n/stats/help",
+		Text:   "/auth\n/stats [project|label|priority] [today|week|month|YYYY-MM-DD..YYYY-MM-DD]\n/timezone [Area/City|reset]\n/add <task>\n/today\n/timer [task]\n/stop\n/status\n/writeback [off|comment|duration]\n/logout\n/help",
 	})
 }
 
+// statsHandler answers /stats [project|label|priority] [today|week|month|YYYY-MM-DD..YYYY-MM-DD].
 func (th *TelegramBotHandlers) statsHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
 	chatID := update.Message.Chat.ID
-	timeSpent, tasks := th.r.GetUserStats(ctx, chatID)
-	res := fmt.Sprintf("You spent: %d\n", timeSpent)
+	settings, err := th.r.GetChatSettings(ctx, chatID)
+	if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to load stats, please try again",
+		})
+		return
+	}
+
+	var by models.StatsGrouping
+	period, periodName := models.Period{}, "all time"
+	for _, arg := range strings.Fields(update.Message.Text)[1:] {
+		switch g := models.StatsGrouping(strings.ToLower(arg)); g {
+		case models.StatsByProject, models.StatsByLabel, models.StatsByPriority:
+			by = g
+			continue
+		}
+		period, periodName, err = parsePeriod(arg, time.Now().In(settings.Location), settings.WeekStart)
+		if err != nil {
+			text := statsUsage
+			if !errors.Is(err, errUnknownPeriod) {
+				text = fmt.Sprintf("%v\n%s", err, statsUsage)
+			}
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   text,
+			})
+			return
+		}
+	}
+
+	if by != "" {
+		th.groupedStats(ctx, b, chatID, by, period, periodName)
+		return
+	}
+	timeSpent, tasks, err := th.r.GetUserStats(ctx, chatID, period)
+	if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to load stats, please try again",
+		})
+		return
+	}
+	res := fmt.Sprintf("You spent %s: %s\n", periodName, duration.Format(uint32(timeSpent)))
 	for _, t := range tasks {
-		res += fmt.Sprintf("Task: %s - %d\n", t.Task, t.TimeSpent)
+		res += fmt.Sprintf("Task: %s - %s\n", t.Task, duration.Format(uint32(t.TimeSpent)))
 	}
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
@@ -168,10 +285,642 @@ func (th *TelegramBotHandlers) statsHandler(ctx context.Context, b *bot.Bot, upd
 	})
 }
 
+func (th *TelegramBotHandlers) groupedStats(ctx context.Context, b *bot.Bot, chatID int64, by models.StatsGrouping, period models.Period, periodName string) {
+	if by == models.StatsByProject {
+		// stale names are still better than none, so go on if Todoist can't be reached
+		if err := th.projects.SyncProjects(ctx, chatID); err != nil {
+			logger.Log.Warn("Error in syncing project names",
+				zap.Int64("chat_id", chatID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	groups, err := th.r.GetGroupedStats(ctx, chatID, by, period, th.hiddenLabels)
+	if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to load stats, please try again",
+		})
+		return
+	}
+	if len(groups) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Nothing tracked %s", periodName),
+		})
+		return
+	}
+	res := fmt.Sprintf("Time by %s, %s:\n", by, periodName)
+	for _, g := range groups {
+		res += fmt.Sprintf("%s - %s\n", g.Name, duration.Format(uint32(g.TimeSpent)))
+	}
+	if by == models.StatsByLabel {
+		res += "Tasks with several labels count for each of them"
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   res,
+	})
+}
+
+// timezoneHandler shows the chat's timezone, or overrides it with /timezone Area/City.
+// /timezone reset goes back to the Todoist profile timezone.
+func (th *TelegramBotHandlers) timezoneHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) == 0 {
+		settings, err := th.r.GetChatSettings(ctx, chatID)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "Failed to load timezone, please try again",
+			})
+			return
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Your timezone is %s. Change it with /timezone Area/City", settings.Location),
+		})
+		return
+	}
+
+	timezone := args[0]
+	if strings.EqualFold(timezone, "reset") {
+		timezone = ""
+	} else if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Unknown timezone %s, use a name like Europe/Berlin", timezone),
+		})
+		return
+	}
+	err := th.r.SetChatTimezone(ctx, chatID, timezone)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Use /start first",
+		})
+		return
+	} else if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to set timezone, please try again",
+		})
+		return
+	}
+	text := fmt.Sprintf("Timezone set to %s", timezone)
+	if timezone == "" {
+		text = "Timezone reset to your Todoist profile"
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	})
+}
+
+// writeBackHandler shows or sets what is written to Todoist tasks once their time is
+// tracked: nothing, a comment, or a comment and the task's duration.
+func (th *TelegramBotHandlers) writeBackHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) == 0 {
+		settings, err := th.r.GetChatSettings(ctx, chatID)
+		if err != nil {
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: chatID,
+				Text:   "Failed to load settings, please try again",
+			})
+			return
+		}
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Write back is %s. Change it with %s", settings.WriteBack, writeBackUsage),
+		})
+		return
+	}
+
+	mode := models.WriteBackMode(strings.ToLower(args[0]))
+	switch mode {
+	case models.WriteBackOff, models.WriteBackComment, models.WriteBackDuration:
+	default:
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Usage: " + writeBackUsage,
+		})
+		return
+	}
+	err := th.r.SetChatWriteBack(ctx, chatID, mode)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Use /start first",
+		})
+		return
+	} else if err != nil {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to set write back, please try again",
+		})
+		return
+	}
+	text := "Tracked time is no longer written to Todoist"
+	switch mode {
+	case models.WriteBackComment:
+		text = "Tracked time will be added to the Todoist task as a comment"
+	case models.WriteBackDuration:
+		text = "Tracked time will be added to the Todoist task as a comment and set as its duration"
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	})
+}
+
+// addHandler creates a Todoist task from the rest of the message, which Todoist parses
+// like its quick add bar.
+func (th *TelegramBotHandlers) addHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	text := commandArgs(update.Message.Text)
+	if text == "" {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   addUsage,
+		})
+		return
+	}
+	task, project, err := th.tasks.QuickAdd(ctx, chatID, text)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "No Todoist account is linked, use /auth to link one",
+		})
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in adding task",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to add the task, please try again",
+		})
+		return
+	}
+
+	projectName := project.Name
+	if projectName == "" {
+		projectName = project.ID
+	}
+	res := fmt.Sprintf("Added: %s\nProject: %s", task.Content, projectName)
+	if task.Due != nil {
+		due := task.Due.String
+		if due == "" {
+			due = task.Due.Date
+		}
+		res += "\nDue: " + due
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   res,
+		ReplyMarkup: &m.InlineKeyboardMarkup{
+			InlineKeyboard: [][]m.InlineKeyboardButton{
+				{{Text: "Open in Todoist", URL: taskURL + task.ID}},
+			},
+		},
+	})
+}
+
+// commandArgs returns the text after the command of a message. The command may be
+// followed by any white space, like a line break.
+func commandArgs(text string) string {
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(text[i:])
+}
+
+// todayHandler lists the tasks due today with buttons to complete them, with or without
+// being asked for the time spent.
+func (th *TelegramBotHandlers) todayHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	tasks, err := th.tasks.Today(ctx, chatID)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "No Todoist account is linked, use /auth to link one",
+		})
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in getting today tasks",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to get your tasks, please try again",
+		})
+		return
+	}
+	if len(tasks) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Nothing due today",
+		})
+		return
+	}
+
+	res := "Due today:\n"
+	keyboard := make([][]m.InlineKeyboardButton, 0, len(tasks))
+	for i, task := range tasks {
+		res += fmt.Sprintf("%d. %s\n", i+1, task.Content)
+		keyboard = append(keyboard, []m.InlineKeyboardButton{
+			{Text: fmt.Sprintf("%d. Done", i+1), CallbackData: todayDoneCallback + task.ID},
+			{Text: fmt.Sprintf("%d. Done + time", i+1), CallbackData: todayTrackCallback + task.ID},
+		})
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        res,
+		ReplyMarkup: &m.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// todayCallback completes the task of a pressed /today button and drops its row from
+// the keyboard. The completion is tracked like one made in Todoist.
+func (th *TelegramBotHandlers) todayCallback(ctx context.Context, b *bot.Bot, update *m.Update) {
+	query := update.CallbackQuery
+	msg := query.Message.Message
+	if msg == nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "This list is too old, use /today again",
+		})
+		return
+	}
+	chatID := msg.Chat.ID
+	taskID, track := strings.CutPrefix(query.Data, todayTrackCallback)
+	if !track {
+		taskID = strings.TrimPrefix(query.Data, todayDoneCallback)
+	}
+
+	task, err := th.tasks.Complete(ctx, chatID, taskID, track)
+	if err != nil {
+		logger.Log.Error("Error in completing task",
+			zap.Int64("chat_id", chatID),
+			zap.String("task_id", taskID),
+			zap.Error(err),
+		)
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "Failed to complete the task, please try again",
+		})
+		return
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            "Completed: " + task.Content,
+	})
+
+	keyboard := make([][]m.InlineKeyboardButton, 0, len(msg.ReplyMarkup.InlineKeyboard))
+	for _, row := range msg.ReplyMarkup.InlineKeyboard {
+		if len(row) > 0 && strings.HasSuffix(row[0].CallbackData, ":"+taskID) {
+			continue
+		}
+		keyboard = append(keyboard, row)
+	}
+	b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:      chatID,
+		MessageID:   msg.ID,
+		ReplyMarkup: &m.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// trackTime stores the time given for a prompted task and returns the answer for the
+// chat. done is false if the time could not be stored and the prompt stays open.
+func (th *TelegramBotHandlers) trackTime(ctx context.Context, chatID int64, val models.WebHookParsed, timeSpent uint32) (text string, done bool) {
+	val.TimeSpent = timeSpent
+	stored, err := th.tracked.StoreTaskTracked(ctx, chatID, val)
+	if err != nil {
+		return "Failed to store time, please try again", false
+	}
+	if !stored {
+		return fmt.Sprintf("Task: %s is already tracked", val.Task), true
+	}
+	th.writer.WriteBack(ctx, val)
+	return fmt.Sprintf("Task: %s successfully tracked: %s", val.Task, duration.Format(val.TimeSpent)), true
+}
+
+// timePromptKeyboard offers quick picks for the time of a completed task.
+func timePromptKeyboard() *m.InlineKeyboardMarkup {
+	picks := make([]m.InlineKeyboardButton, 0, len(timeQuickPicks))
+	for _, minutes := range timeQuickPicks {
+		picks = append(picks, m.InlineKeyboardButton{
+			Text:         duration.Format(minutes),
+			CallbackData: timeCallbackPrefix + strconv.FormatUint(uint64(minutes), 10),
+		})
+	}
+	return &m.InlineKeyboardMarkup{
+		InlineKeyboard: [][]m.InlineKeyboardButton{
+			picks,
+			{
+				{Text: "Custom", CallbackData: timeCustomCallback},
+				{Text: "Skip", CallbackData: timeSkipCallback},
+			},
+		},
+	}
+}
+
+// timeCallback handles the buttons of the time prompt. A pick stores the time and a skip
+// drops the task; both edit the prompt to show the outcome without the keyboard. Custom
+// waits for the time in a reply.
+func (th *TelegramBotHandlers) timeCallback(ctx context.Context, b *bot.Bot, update *m.Update) {
+	query := update.CallbackQuery
+	msg := query.Message.Message
+	if msg == nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "This prompt is too old",
+		})
+		return
+	}
+	chatID := msg.Chat.ID
+
+	pick := th.pickTime(ctx, chatID, msg.ID, query.Data)
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            pick.answer,
+	})
+	if pick.result != "" {
+		b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    chatID,
+			MessageID: msg.ID,
+			Text:      pick.result,
+		})
+	} else if pick.dropKeyboard {
+		b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+			ChatID:    chatID,
+			MessageID: msg.ID,
+		})
+	}
+}
+
+// timePick is the outcome of a time prompt button.
+type timePick struct {
+	// answer is shown to the user who pressed the button
+	answer string
+	// result replaces the prompt, which drops its keyboard
+	result string
+	// dropKeyboard removes the keyboard of a prompt that has no result
+	dropKeyboard bool
+}
+
+// parseTimeCallback reads the data of a time prompt button, which is either a number
+// of minutes, custom or skip.
+func parseTimeCallback(data string) (minutes uint32, custom, skip bool, err error) {
+	switch data {
+	case timeCustomCallback:
+		return 0, true, false, nil
+	case timeSkipCallback:
+		return 0, false, true, nil
+	}
+	arg, ok := strings.CutPrefix(data, timeCallbackPrefix)
+	if !ok {
+		return 0, false, false, fmt.Errorf("not a time callback: %q", data)
+	}
+	parsed, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil || parsed == 0 {
+		return 0, false, false, fmt.Errorf("invalid minutes in time callback: %q", data)
+	}
+	return uint32(parsed), false, false, nil
+}
+
+// pickTime applies a pressed time prompt button to the task waiting for its time.
+// The task keeps waiting if its time could not be stored.
+func (th *TelegramBotHandlers) pickTime(ctx context.Context, chatID int64, messageID int, data string) timePick {
+	minutes, custom, skip, err := parseTimeCallback(data)
+	if err != nil {
+		logger.Log.Warn("Unexpected time callback",
+			zap.String("data", data),
+			zap.Error(err),
+		)
+		return timePick{}
+	}
+	if custom {
+		return timePick{answer: "Reply to the message with the time, e.g. 1h30m"}
+	}
+
+	// taken out at once, so a double tap cannot store the time twice
+	key := promptKey{chatID: chatID, messageID: messageID}
+	loaded, ok := th.mes.LoadAndDelete(key)
+	// never store a task of another chat under this one
+	if ok && loaded.(models.WebHookParsed).ChatID != chatID {
+		logger.Log.Warn("Time prompt of another chat",
+			zap.Int64("chat_id", chatID),
+			zap.Int64("prompt_chat_id", loaded.(models.WebHookParsed).ChatID),
+		)
+		ok = false
+	}
+	if !ok {
+		return timePick{answer: "This task is already handled", dropKeyboard: true}
+	}
+	val := loaded.(models.WebHookParsed)
+
+	if skip {
+		return timePick{result: fmt.Sprintf("Task: %s is not tracked", val.Task)}
+	}
+	text, done := th.trackTime(ctx, chatID, val, minutes)
+	if !done {
+		th.mes.Store(key, val)
+		return timePick{answer: text}
+	}
+	return timePick{result: text}
+}
+
+// timerHandler answers /timer <task> by starting a timer for a task that is not in
+// Todoist. Without a task it lists the tasks due today to pick one from.
+func (th *TelegramBotHandlers) timerHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	if text := commandArgs(update.Message.Text); text != "" {
+		th.startTimer(ctx, b, chatID, models.Timer{Task: text})
+		return
+	}
+
+	tasks, err := th.tasks.Today(ctx, chatID)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "No Todoist account is linked, use /timer <task> or /auth to link one",
+		})
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in getting today tasks",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to get your tasks, please try again",
+		})
+		return
+	}
+	if len(tasks) == 0 {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Nothing due today, use /timer <task>",
+		})
+		return
+	}
+	keyboard := make([][]m.InlineKeyboardButton, 0, len(tasks))
+	for _, task := range tasks {
+		keyboard = append(keyboard, []m.InlineKeyboardButton{
+			{Text: task.Content, CallbackData: timerCallbackPrefix + task.ID},
+		})
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        "Pick a task to start the timer:",
+		ReplyMarkup: &m.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+}
+
+// timerCallback starts the timer for the task picked from the /timer list. The timer
+// stops by itself once the task is completed in Todoist.
+func (th *TelegramBotHandlers) timerCallback(ctx context.Context, b *bot.Bot, update *m.Update) {
+	query := update.CallbackQuery
+	msg := query.Message.Message
+	if msg == nil {
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "This list is too old, use /timer again",
+		})
+		return
+	}
+	chatID := msg.Chat.ID
+	taskID := strings.TrimPrefix(query.Data, timerCallbackPrefix)
+
+	task, err := th.tasks.Task(ctx, chatID, taskID)
+	if err != nil {
+		logger.Log.Error("Error in getting task",
+			zap.Int64("chat_id", chatID),
+			zap.String("task_id", taskID),
+			zap.Error(err),
+		)
+		b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: query.ID,
+			Text:            "Failed to get the task, please try again",
+		})
+		return
+	}
+	b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+	})
+	b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    chatID,
+		MessageID: msg.ID,
+	})
+	th.startTimer(ctx, b, chatID, models.Timer{
+		TaskID:    task.ID,
+		Task:      task.Content,
+		ProjectID: task.ProjectID,
+		SectionID: task.SectionID,
+		Labels:    task.Labels,
+		Priority:  task.Priority,
+	})
+}
+
+func (th *TelegramBotHandlers) startTimer(ctx context.Context, b *bot.Bot, chatID int64, timer models.Timer) {
+	running, started, err := th.timers.Start(ctx, chatID, timer)
+	if err != nil {
+		logger.Log.Error("Error in starting timer",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to start the timer, please try again",
+		})
+		return
+	}
+	if !started {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Timer for %s is already running, use /stop first", running.Task),
+		})
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("Timer started for %s, use /stop when done", running.Task),
+	})
+}
+
+// stopHandler answers /stop by storing the time of the running timer.
+func (th *TelegramBotHandlers) stopHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	wp, err := th.timers.Stop(ctx, chatID)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "No timer is running",
+		})
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in stopping timer",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to stop the timer, please try again",
+		})
+		return
+	}
+	if !wp.TimerStopped {
+		// an earlier /stop stored the time but failed to remove the timer
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("Timer for %s was already stopped", wp.Task),
+		})
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("Timer stopped. Task: %s successfully tracked: %s", wp.Task, duration.Format(wp.TimeSpent)),
+	})
+}
+
+// statusHandler answers /status with the running timer.
+func (th *TelegramBotHandlers) statusHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	timer, err := th.timers.Status(ctx, chatID)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "No timer is running, use /timer to start one",
+		})
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in getting timer",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to get the timer, please try again",
+		})
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   fmt.Sprintf("Timer for %s is running: %s", timer.Task, duration.Format(th.timers.Elapsed(timer))),
+	})
+}
+
 func (th *TelegramBotHandlers) authHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
 	chatID := update.Message.Chat.ID
-	ch := strconv.FormatInt(chatID, 10)
-	link := "https://snbn.online/auth?chat_id=" + ch
+	link := th.publicURL + "/auth?token=" + th.links.Sign(chatID, time.Now())
 	b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    chatID,
 		Text:      "Auth using this [link](" + link + ")",
@@ -179,3 +928,29 @@ func (th *TelegramBotHandlers) authHandler(ctx context.Context, b *bot.Bot, upda
 	})
 	th.storage.SetStatus(chatID, todoistRegisteringState)
 }
+
+func (th *TelegramBotHandlers) logoutHandler(ctx context.Context, b *bot.Bot, update *m.Update) {
+	chatID := update.Message.Chat.ID
+	err := th.accounts.Logout(ctx, chatID)
+	if errors.Is(err, repository.ErrNotFound) {
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "No Todoist account is linked, use /auth to link one",
+		})
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in logging out",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Failed to log out of Todoist, please try again",
+		})
+		return
+	}
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Logged out. Completed tasks are no longer tracked in this chat",
+	})
+}
@@ -0,0 +1,838 @@
+package tgbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"github.com/go-telegram/bot"
+	m "github.com/go-telegram/bot/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const testChatID int64 = 42
+
+type fakeTaskStore struct {
+	err     error
+	tracked []models.WebHookParsed
+}
+
+func (f *fakeTaskStore) StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, t := range f.tracked {
+		if t.EventKey == task.EventKey {
+			return false, nil
+		}
+	}
+	f.tracked = append(f.tracked, task)
+	return true, nil
+}
+
+type fakeWriter struct {
+	written []models.WebHookParsed
+}
+
+func (f *fakeWriter) WriteBack(ctx context.Context, wp models.WebHookParsed) {
+	f.written = append(f.written, wp)
+}
+
+// fakeTelegram stands in for the Bot API and records the requests made by the handlers.
+type fakeTelegram struct {
+	mu    sync.Mutex
+	calls []telegramCall
+}
+
+type telegramCall struct {
+	method string
+	params map[string]string
+}
+
+func newTestBot(t *testing.T) (*bot.Bot, *fakeTelegram) {
+	t.Helper()
+	tg := &fakeTelegram{}
+	srv := httptest.NewServer(http.HandlerFunc(tg.serve))
+	t.Cleanup(srv.Close)
+	b, err := bot.New("test-token", bot.WithServerURL(srv.URL), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, tg
+}
+
+func (tg *fakeTelegram) serve(w http.ResponseWriter, r *http.Request) {
+	params := map[string]string{}
+	if err := r.ParseMultipartForm(1 << 20); err == nil {
+		for key, values := range r.MultipartForm.Value {
+			params[key] = values[0]
+		}
+	}
+	method := path.Base(r.URL.Path)
+	tg.mu.Lock()
+	tg.calls = append(tg.calls, telegramCall{method: method, params: params})
+	tg.mu.Unlock()
+
+	result := `{"message_id":1}`
+	if method == "answerCallbackQuery" {
+		result = "true"
+	}
+	fmt.Fprintf(w, `{"ok":true,"result":%s}`, result)
+}
+
+// requests returns the parameters of the requests made with method, in order.
+func (tg *fakeTelegram) requests(method string) []map[string]string {
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	var res []map[string]string
+	for _, call := range tg.calls {
+		if call.method == method {
+			res = append(res, call.params)
+		}
+	}
+	return res
+}
+
+// sent returns the texts of the messages sent to the test chat.
+func (tg *fakeTelegram) sent(t *testing.T) []string {
+	t.Helper()
+	var texts []string
+	for _, params := range tg.requests("sendMessage") {
+		assert.Equal(t, strconv.FormatInt(testChatID, 10), params["chat_id"])
+		texts = append(texts, params["text"])
+	}
+	return texts
+}
+
+func keyboardOf(t *testing.T, params map[string]string) [][]m.InlineKeyboardButton {
+	t.Helper()
+	var markup m.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(params["reply_markup"]), &markup); err != nil {
+		t.Fatalf("reply_markup %q: %v", params["reply_markup"], err)
+	}
+	return markup.InlineKeyboard
+}
+
+func commandUpdate(text string) *m.Update {
+	return &m.Update{Message: &m.Message{Chat: m.Chat{ID: testChatID}, Text: text}}
+}
+
+// fakeTasks serves the Todoist tasks of the test chat.
+type fakeTasks struct {
+	err error
+	// added are the texts given to QuickAdd, which answers with addedTask in project
+	added     []string
+	addedTask models.Task
+	project   models.Project
+	today     []models.Task
+	// completed are the tasks closed with Complete, by whether they are tracked
+	completed map[string]bool
+}
+
+func (f *fakeTasks) QuickAdd(ctx context.Context, chatID int64, text string) (models.Task, models.Project, error) {
+	if f.err != nil {
+		return models.Task{}, models.Project{}, f.err
+	}
+	f.added = append(f.added, text)
+	return f.addedTask, f.project, nil
+}
+
+func (f *fakeTasks) Today(ctx context.Context, chatID int64) ([]models.Task, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.today, nil
+}
+
+func (f *fakeTasks) Task(ctx context.Context, chatID int64, taskID string) (models.Task, error) {
+	if f.err != nil {
+		return models.Task{}, f.err
+	}
+	for _, task := range f.today {
+		if task.ID == taskID {
+			return task, nil
+		}
+	}
+	return models.Task{}, repository.ErrNotFound
+}
+
+func (f *fakeTasks) Complete(ctx context.Context, chatID int64, taskID string, track bool) (models.Task, error) {
+	task, err := f.Task(ctx, chatID, taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+	if f.completed == nil {
+		f.completed = map[string]bool{}
+	}
+	f.completed[taskID] = track
+	return task, nil
+}
+
+func TestAddHandler(t *testing.T) {
+	added := models.Task{ID: "task1", Content: "Call Alice", Due: &models.Due{Date: "2026-10-17", String: "tomorrow 5pm"}}
+
+	tests := []struct {
+		name      string
+		text      string
+		tasks     *fakeTasks
+		wantAdded []string
+		want      string
+	}{
+		{
+			name:      "Adds the rest of the message",
+			text:      "/add Call Alice tomorrow 5pm #Work @calls p2",
+			tasks:     &fakeTasks{addedTask: added, project: models.Project{ID: "p1", Name: "Work"}},
+			wantAdded: []string{"Call Alice tomorrow 5pm #Work @calls p2"},
+			want:      "Added: Call Alice\nProject: Work\nDue: tomorrow 5pm",
+		},
+		{
+			name:      "Task after a line break",
+			text:      "/add\n  Call Alice  ",
+			tasks:     &fakeTasks{addedTask: added, project: models.Project{ID: "p1", Name: "Work"}},
+			wantAdded: []string{"Call Alice"},
+			want:      "Added: Call Alice\nProject: Work\nDue: tomorrow 5pm",
+		},
+		{
+			name:      "Project without a name and due without a string",
+			text:      "/add Call Alice",
+			tasks:     &fakeTasks{addedTask: models.Task{ID: "task1", Content: "Call Alice", Due: &models.Due{Date: "2026-10-17"}}, project: models.Project{ID: "p1"}},
+			wantAdded: []string{"Call Alice"},
+			want:      "Added: Call Alice\nProject: p1\nDue: 2026-10-17",
+		},
+		{
+			name:  "No task",
+			text:  "/add",
+			tasks: &fakeTasks{},
+			want:  addUsage,
+		},
+		{
+			name:  "Only white space",
+			text:  "/add   \n ",
+			tasks: &fakeTasks{},
+			want:  addUsage,
+		},
+		{
+			name:  "No linked account",
+			text:  "/add Call Alice",
+			tasks: &fakeTasks{err: repository.ErrNotFound},
+			want:  "No Todoist account is linked, use /auth to link one",
+		},
+		{
+			name:  "Todoist error",
+			text:  "/add Call Alice",
+			tasks: &fakeTasks{err: errors.New("todoist down")},
+			want:  "Failed to add the task, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{tasks: tt.tasks}
+
+			th.addHandler(context.Background(), b, commandUpdate(tt.text))
+
+			assert.Equal(t, tt.wantAdded, tt.tasks.added)
+			assert.Equal(t, []string{tt.want}, tg.sent(t))
+			if tt.wantAdded != nil {
+				keyboard := keyboardOf(t, tg.requests("sendMessage")[0])
+				assert.Equal(t, [][]m.InlineKeyboardButton{{{Text: "Open in Todoist", URL: taskURL + "task1"}}}, keyboard)
+			}
+		})
+	}
+}
+
+func TestTodayHandler(t *testing.T) {
+	today := []models.Task{{ID: "1", Content: "Write report"}, {ID: "11", Content: "Call Alice"}}
+
+	tests := []struct {
+		name         string
+		tasks        *fakeTasks
+		want         string
+		wantKeyboard [][]m.InlineKeyboardButton
+	}{
+		{
+			name:  "Lists the tasks with their buttons",
+			tasks: &fakeTasks{today: today},
+			want:  "Due today:\n1. Write report\n2. Call Alice\n",
+			wantKeyboard: [][]m.InlineKeyboardButton{
+				{{Text: "1. Done", CallbackData: "today:done:1"}, {Text: "1. Done + time", CallbackData: "today:track:1"}},
+				{{Text: "2. Done", CallbackData: "today:done:11"}, {Text: "2. Done + time", CallbackData: "today:track:11"}},
+			},
+		},
+		{
+			name:  "Nothing due",
+			tasks: &fakeTasks{},
+			want:  "Nothing due today",
+		},
+		{
+			name:  "No linked account",
+			tasks: &fakeTasks{err: repository.ErrNotFound},
+			want:  "No Todoist account is linked, use /auth to link one",
+		},
+		{
+			name:  "Todoist error",
+			tasks: &fakeTasks{err: errors.New("todoist down")},
+			want:  "Failed to get your tasks, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{tasks: tt.tasks}
+
+			th.todayHandler(context.Background(), b, commandUpdate("/today"))
+
+			assert.Equal(t, []string{tt.want}, tg.sent(t))
+			if tt.wantKeyboard != nil {
+				assert.Equal(t, tt.wantKeyboard, keyboardOf(t, tg.requests("sendMessage")[0]))
+			}
+		})
+	}
+}
+
+func TestTodayCallback(t *testing.T) {
+	const listID = 9
+	today := []models.Task{{ID: "1", Content: "Write report"}, {ID: "11", Content: "Call Alice"}}
+	list := m.InlineKeyboardMarkup{InlineKeyboard: [][]m.InlineKeyboardButton{
+		{{Text: "1. Done", CallbackData: "today:done:1"}, {Text: "1. Done + time", CallbackData: "today:track:1"}},
+		{{Text: "2. Done", CallbackData: "today:done:11"}, {Text: "2. Done + time", CallbackData: "today:track:11"}},
+	}}
+
+	tests := []struct {
+		name          string
+		tasks         *fakeTasks
+		data          string
+		want          string
+		wantCompleted map[string]bool
+		// wantKeyboard is the keyboard left on the list, nil if it is not edited
+		wantKeyboard [][]m.InlineKeyboardButton
+	}{
+		{
+			name:          "Done drops the row of the task",
+			tasks:         &fakeTasks{today: today},
+			data:          "today:done:1",
+			want:          "Completed: Write report",
+			wantCompleted: map[string]bool{"1": false},
+			wantKeyboard:  list.InlineKeyboard[1:],
+		},
+		{
+			name:          "Done + time tracks the task",
+			tasks:         &fakeTasks{today: today},
+			data:          "today:track:11",
+			want:          "Completed: Call Alice",
+			wantCompleted: map[string]bool{"11": true},
+			wantKeyboard:  list.InlineKeyboard[:1],
+		},
+		{
+			name:  "Failed completion keeps the list",
+			tasks: &fakeTasks{today: today, err: errors.New("todoist down")},
+			data:  "today:done:1",
+			want:  "Failed to complete the task, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{tasks: tt.tasks}
+			update := &m.Update{CallbackQuery: &m.CallbackQuery{
+				ID:   "query1",
+				Data: tt.data,
+				Message: m.MaybeInaccessibleMessage{Message: &m.Message{
+					ID:          listID,
+					Chat:        m.Chat{ID: testChatID},
+					ReplyMarkup: list,
+				}},
+			}}
+
+			th.todayCallback(context.Background(), b, update)
+
+			assert.Equal(t, tt.wantCompleted, tt.tasks.completed)
+			answers := tg.requests("answerCallbackQuery")
+			if assert.Len(t, answers, 1) {
+				assert.Equal(t, "query1", answers[0]["callback_query_id"])
+				assert.Equal(t, tt.want, answers[0]["text"])
+			}
+			edits := tg.requests("editMessageReplyMarkup")
+			if tt.wantKeyboard == nil {
+				assert.Empty(t, edits)
+				return
+			}
+			if assert.Len(t, edits, 1) {
+				assert.Equal(t, strconv.Itoa(listID), edits[0]["message_id"])
+				assert.Equal(t, tt.wantKeyboard, keyboardOf(t, edits[0]))
+			}
+		})
+	}
+}
+
+func TestTodayCallback_tooOld(t *testing.T) {
+	b, tg := newTestBot(t)
+	tasks := &fakeTasks{}
+	th := &TelegramBotHandlers{tasks: tasks}
+	update := &m.Update{CallbackQuery: &m.CallbackQuery{
+		ID:   "query1",
+		Data: "today:done:1",
+		Message: m.MaybeInaccessibleMessage{
+			Type:                m.MaybeInaccessibleMessageTypeInaccessibleMessage,
+			InaccessibleMessage: &m.InaccessibleMessage{Chat: m.Chat{ID: testChatID}},
+		},
+	}}
+
+	th.todayCallback(context.Background(), b, update)
+
+	assert.Empty(t, tasks.completed)
+	answers := tg.requests("answerCallbackQuery")
+	if assert.Len(t, answers, 1) {
+		assert.Equal(t, "This list is too old, use /today again", answers[0]["text"])
+	}
+	assert.Empty(t, tg.requests("editMessageReplyMarkup"))
+}
+
+// fakeTimers runs the timer of the test chat.
+type fakeTimers struct {
+	err     error
+	running *models.Timer
+	elapsed uint32
+	// stopped is what Stop returns for the running timer
+	stopped models.WebHookParsed
+}
+
+func (f *fakeTimers) Start(ctx context.Context, chatID int64, timer models.Timer) (models.Timer, bool, error) {
+	if f.err != nil {
+		return models.Timer{}, false, f.err
+	}
+	if f.running != nil {
+		return *f.running, false, nil
+	}
+	f.running = &timer
+	return timer, true, nil
+}
+
+func (f *fakeTimers) Status(ctx context.Context, chatID int64) (models.Timer, error) {
+	if f.err != nil {
+		return models.Timer{}, f.err
+	}
+	if f.running == nil {
+		return models.Timer{}, repository.ErrNotFound
+	}
+	return *f.running, nil
+}
+
+func (f *fakeTimers) Elapsed(timer models.Timer) uint32 {
+	return f.elapsed
+}
+
+func (f *fakeTimers) Stop(ctx context.Context, chatID int64) (models.WebHookParsed, error) {
+	if f.err != nil {
+		return models.WebHookParsed{}, f.err
+	}
+	if f.running == nil {
+		return models.WebHookParsed{}, repository.ErrNotFound
+	}
+	f.running = nil
+	return f.stopped, nil
+}
+
+func TestTimerHandler(t *testing.T) {
+	today := []models.Task{{ID: "1", Content: "Write report"}, {ID: "11", Content: "Call Alice"}}
+
+	tests := []struct {
+		name         string
+		text         string
+		tasks        *fakeTasks
+		timers       *fakeTimers
+		want         string
+		wantRunning  *models.Timer
+		wantKeyboard [][]m.InlineKeyboardButton
+	}{
+		{
+			name:        "Starts a timer for the task",
+			text:        "/timer Plan the trip",
+			timers:      &fakeTimers{},
+			want:        "Timer started for Plan the trip, use /stop when done",
+			wantRunning: &models.Timer{Task: "Plan the trip"},
+		},
+		{
+			name:        "Task after a line break",
+			text:        "/timer\nPlan the trip ",
+			timers:      &fakeTimers{},
+			want:        "Timer started for Plan the trip, use /stop when done",
+			wantRunning: &models.Timer{Task: "Plan the trip"},
+		},
+		{
+			name:        "Timer already running",
+			text:        "/timer Plan the trip",
+			timers:      &fakeTimers{running: &models.Timer{Task: "Write report"}},
+			want:        "Timer for Write report is already running, use /stop first",
+			wantRunning: &models.Timer{Task: "Write report"},
+		},
+		{
+			name:   "Failed start",
+			text:   "/timer Plan the trip",
+			timers: &fakeTimers{err: errors.New("db down")},
+			want:   "Failed to start the timer, please try again",
+		},
+		{
+			name:   "Lists the tasks due today",
+			text:   "/timer",
+			tasks:  &fakeTasks{today: today},
+			timers: &fakeTimers{},
+			want:   "Pick a task to start the timer:",
+			wantKeyboard: [][]m.InlineKeyboardButton{
+				{{Text: "Write report", CallbackData: "timer:1"}},
+				{{Text: "Call Alice", CallbackData: "timer:11"}},
+			},
+		},
+		{
+			name:   "Nothing due",
+			text:   "/timer",
+			tasks:  &fakeTasks{},
+			timers: &fakeTimers{},
+			want:   "Nothing due today, use /timer <task>",
+		},
+		{
+			name:   "No linked account",
+			text:   "/timer",
+			tasks:  &fakeTasks{err: repository.ErrNotFound},
+			timers: &fakeTimers{},
+			want:   "No Todoist account is linked, use /timer <task> or /auth to link one",
+		},
+		{
+			name:   "Todoist error",
+			text:   "/timer",
+			tasks:  &fakeTasks{err: errors.New("todoist down")},
+			timers: &fakeTimers{},
+			want:   "Failed to get your tasks, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{tasks: tt.tasks, timers: tt.timers}
+
+			th.timerHandler(context.Background(), b, commandUpdate(tt.text))
+
+			assert.Equal(t, []string{tt.want}, tg.sent(t))
+			assert.Equal(t, tt.wantRunning, tt.timers.running)
+			if tt.wantKeyboard != nil {
+				assert.Equal(t, tt.wantKeyboard, keyboardOf(t, tg.requests("sendMessage")[0]))
+			}
+		})
+	}
+}
+
+func TestTimerCallback(t *testing.T) {
+	const listID = 9
+	task := models.Task{ID: "1", Content: "Write report", ProjectID: "p1", SectionID: "s1", Labels: []string{"deep"}, Priority: 3}
+
+	tests := []struct {
+		name        string
+		tasks       *fakeTasks
+		timers      *fakeTimers
+		data        string
+		wantAnswer  string
+		wantSent    []string
+		wantRunning *models.Timer
+		// wantDropped is whether the keyboard of the list is removed
+		wantDropped bool
+	}{
+		{
+			name:        "Starts a timer for the picked task",
+			tasks:       &fakeTasks{today: []models.Task{task}},
+			timers:      &fakeTimers{},
+			data:        "timer:1",
+			wantSent:    []string{"Timer started for Write report, use /stop when done"},
+			wantRunning: &models.Timer{TaskID: "1", Task: "Write report", ProjectID: "p1", SectionID: "s1", Labels: []string{"deep"}, Priority: 3},
+			wantDropped: true,
+		},
+		{
+			name:        "Timer already running",
+			tasks:       &fakeTasks{today: []models.Task{task}},
+			timers:      &fakeTimers{running: &models.Timer{Task: "Plan the trip"}},
+			data:        "timer:1",
+			wantSent:    []string{"Timer for Plan the trip is already running, use /stop first"},
+			wantRunning: &models.Timer{Task: "Plan the trip"},
+			wantDropped: true,
+		},
+		{
+			name:       "Task is gone",
+			tasks:      &fakeTasks{},
+			timers:     &fakeTimers{},
+			data:       "timer:1",
+			wantAnswer: "Failed to get the task, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{tasks: tt.tasks, timers: tt.timers}
+			update := &m.Update{CallbackQuery: &m.CallbackQuery{
+				ID:   "query1",
+				Data: tt.data,
+				Message: m.MaybeInaccessibleMessage{Message: &m.Message{
+					ID:   listID,
+					Chat: m.Chat{ID: testChatID},
+				}},
+			}}
+
+			th.timerCallback(context.Background(), b, update)
+
+			answers := tg.requests("answerCallbackQuery")
+			if assert.Len(t, answers, 1) {
+				assert.Equal(t, tt.wantAnswer, answers[0]["text"])
+			}
+			assert.Equal(t, tt.wantSent, tg.sent(t))
+			assert.Equal(t, tt.wantRunning, tt.timers.running)
+			edits := tg.requests("editMessageReplyMarkup")
+			if !tt.wantDropped {
+				assert.Empty(t, edits)
+				return
+			}
+			if assert.Len(t, edits, 1) {
+				assert.Equal(t, strconv.Itoa(listID), edits[0]["message_id"])
+				assert.Empty(t, edits[0]["reply_markup"])
+			}
+		})
+	}
+}
+
+func TestStopHandler(t *testing.T) {
+	running := &models.Timer{Task: "Write report"}
+
+	tests := []struct {
+		name   string
+		timers *fakeTimers
+		want   string
+	}{
+		{
+			name:   "Stores the time",
+			timers: &fakeTimers{running: running, stopped: models.WebHookParsed{Task: "Write report", TimeSpent: 90, TimerStopped: true}},
+			want:   "Timer stopped. Task: Write report successfully tracked: 1h30m",
+		},
+		{
+			name:   "Timer stopped by an earlier /stop",
+			timers: &fakeTimers{running: running, stopped: models.WebHookParsed{Task: "Write report", TimeSpent: 90}},
+			want:   "Timer for Write report was already stopped",
+		},
+		{
+			name:   "No timer",
+			timers: &fakeTimers{},
+			want:   "No timer is running",
+		},
+		{
+			name:   "Failed stop",
+			timers: &fakeTimers{running: running, err: errors.New("db down")},
+			want:   "Failed to stop the timer, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{timers: tt.timers}
+
+			th.stopHandler(context.Background(), b, commandUpdate("/stop"))
+
+			assert.Equal(t, []string{tt.want}, tg.sent(t))
+		})
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		timers *fakeTimers
+		want   string
+	}{
+		{
+			name:   "Running timer",
+			timers: &fakeTimers{running: &models.Timer{Task: "Write report"}, elapsed: 25},
+			want:   "Timer for Write report is running: 25m",
+		},
+		{
+			name:   "No timer",
+			timers: &fakeTimers{},
+			want:   "No timer is running, use /timer to start one",
+		},
+		{
+			name:   "Failed lookup",
+			timers: &fakeTimers{err: errors.New("db down")},
+			want:   "Failed to get the timer, please try again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, tg := newTestBot(t)
+			th := &TelegramBotHandlers{timers: tt.timers}
+
+			th.statusHandler(context.Background(), b, commandUpdate("/status"))
+
+			assert.Equal(t, []string{tt.want}, tg.sent(t))
+		})
+	}
+}
+
+func TestTimePromptKeyboard(t *testing.T) {
+	keyboard := timePromptKeyboard()
+	var picks []uint32
+	for _, row := range keyboard.InlineKeyboard {
+		for _, button := range row {
+			minutes, custom, skip, err := parseTimeCallback(button.CallbackData)
+			assert.NoError(t, err, button.Text)
+			switch {
+			case custom:
+				assert.Equal(t, "Custom", button.Text)
+			case skip:
+				assert.Equal(t, "Skip", button.Text)
+			default:
+				picks = append(picks, minutes)
+			}
+		}
+	}
+	assert.Equal(t, timeQuickPicks, picks)
+}
+
+func TestParseTimeCallback(t *testing.T) {
+	tests := []struct {
+		data        string
+		wantMinutes uint32
+		wantCustom  bool
+		wantSkip    bool
+		wantErr     bool
+	}{
+		{data: "time:15", wantMinutes: 15},
+		{data: "time:120", wantMinutes: 120},
+		{data: "time:custom", wantCustom: true},
+		{data: "time:skip", wantSkip: true},
+		{data: "time:0", wantErr: true},
+		{data: "time:-5", wantErr: true},
+		{data: "time:1h", wantErr: true},
+		{data: "time:", wantErr: true},
+		{data: "today:done:15", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			minutes, custom, skip, err := parseTimeCallback(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMinutes, minutes)
+			assert.Equal(t, tt.wantCustom, custom)
+			assert.Equal(t, tt.wantSkip, skip)
+		})
+	}
+}
+
+func TestPickTime(t *testing.T) {
+	const promptID = 7
+	task := models.WebHookParsed{ChatID: testChatID, TaskID: "task1", Task: "Write report", EventKey: "item:completed:task1"}
+
+	tests := []struct {
+		name string
+		// prompts are the tasks waiting for their time before the button is pressed
+		prompts   map[promptKey]models.WebHookParsed
+		storeErr  error
+		data      string
+		want      timePick
+		wantStore bool
+		// wantWaiting is whether the task still waits for its time afterwards
+		wantWaiting bool
+	}{
+		{
+			name:      "Pick stores the time",
+			prompts:   map[promptKey]models.WebHookParsed{{testChatID, promptID}: task},
+			data:      "time:45",
+			want:      timePick{result: "Task: Write report successfully tracked: 45m"},
+			wantStore: true,
+		},
+		{
+			name:    "Skip drops the task",
+			prompts: map[promptKey]models.WebHookParsed{{testChatID, promptID}: task},
+			data:    "time:skip",
+			want:    timePick{result: "Task: Write report is not tracked"},
+		},
+		{
+			name:        "Custom waits for a reply",
+			prompts:     map[promptKey]models.WebHookParsed{{testChatID, promptID}: task},
+			data:        "time:custom",
+			want:        timePick{answer: "Reply to the message with the time, e.g. 1h30m"},
+			wantWaiting: true,
+		},
+		{
+			name: "Pick that is already handled",
+			data: "time:30",
+			want: timePick{answer: "This task is already handled", dropKeyboard: true},
+		},
+		{
+			name:    "Prompt with the same ID in another chat",
+			prompts: map[promptKey]models.WebHookParsed{{testChatID + 1, promptID}: {ChatID: testChatID + 1, Task: "Other"}},
+			data:    "time:30",
+			want:    timePick{answer: "This task is already handled", dropKeyboard: true},
+		},
+		{
+			name:        "Failed store keeps the prompt",
+			prompts:     map[promptKey]models.WebHookParsed{{testChatID, promptID}: task},
+			storeErr:    errors.New("db down"),
+			data:        "time:30",
+			want:        timePick{answer: "Failed to store time, please try again"},
+			wantWaiting: true,
+		},
+		{
+			name:        "Malformed data keeps the prompt",
+			prompts:     map[promptKey]models.WebHookParsed{{testChatID, promptID}: task},
+			data:        "time:soon",
+			want:        timePick{},
+			wantWaiting: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeTaskStore{err: tt.storeErr}
+			writer := &fakeWriter{}
+			th := &TelegramBotHandlers{tracked: store, writer: writer}
+			for key, val := range tt.prompts {
+				th.mes.Store(key, val)
+			}
+
+			pick := th.pickTime(context.Background(), testChatID, promptID, tt.data)
+			assert.Equal(t, tt.want, pick)
+
+			if tt.wantStore {
+				if assert.Len(t, store.tracked, 1) {
+					assert.Equal(t, uint32(45), store.tracked[0].TimeSpent)
+					assert.Equal(t, testChatID, store.tracked[0].ChatID)
+				}
+				assert.Len(t, writer.written, 1)
+			} else {
+				assert.Empty(t, store.tracked)
+			}
+			_, waiting := th.mes.Load(promptKey{testChatID, promptID})
+			assert.Equal(t, tt.wantWaiting, waiting)
+			for key := range tt.prompts {
+				if key.chatID != testChatID {
+					_, ok := th.mes.Load(key)
+					assert.True(t, ok, "prompts of other chats are left alone")
+				}
+			}
+		})
+	}
+}
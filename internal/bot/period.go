@@ -0,0 +1,50 @@
+package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/bot/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+var errUnknownPeriod = errors.New("unknown period")
+
+// parsePeriod reads a /stats period: today, week, month or an inclusive date range
+// such as 2025-04-01..2025-04-30. Day boundaries are taken in now's location and
+// weeks begin on weekStart. It also returns a description of the period for replies.
+func parsePeriod(arg string, now time.Time, weekStart time.Weekday) (models.Period, string, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch strings.ToLower(arg) {
+	case "today":
+		return models.Period{From: today, To: today.AddDate(0, 0, 1)}, "today", nil
+	case "week":
+		from := today.AddDate(0, 0, -((int(today.Weekday()) - int(weekStart) + 7) % 7))
+		return models.Period{From: from, To: from.AddDate(0, 0, 7)}, "this week", nil
+	case "month":
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return models.Period{From: from, To: from.AddDate(0, 1, 0)}, "this month", nil
+	}
+
+	fromArg, toArg, ok := strings.Cut(arg, "..")
+	if !ok {
+		return models.Period{}, "", errUnknownPeriod
+	}
+	from, err := time.ParseInLocation(dateLayout, fromArg, loc)
+	if err != nil {
+		return models.Period{}, "", fmt.Errorf("bad start date %q, use YYYY-MM-DD", fromArg)
+	}
+	to, err := time.ParseInLocation(dateLayout, toArg, loc)
+	if err != nil {
+		return models.Period{}, "", fmt.Errorf("bad end date %q, use YYYY-MM-DD", toArg)
+	}
+	if to.Before(from) {
+		return models.Period{}, "", fmt.Errorf("range %s ends before it starts", arg)
+	}
+	return models.Period{From: from, To: to.AddDate(0, 0, 1)}, fromArg + ".." + toArg, nil
+}
@@ -0,0 +1,52 @@
+package tgbot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePeriod(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	// Wednesday
+	now := time.Date(2025, 4, 16, 15, 30, 0, 0, loc)
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		arg       string
+		weekStart time.Weekday
+		wantFrom  time.Time
+		wantTo    time.Time
+		wantErr   bool
+	}{
+		{arg: "today", weekStart: time.Monday, wantFrom: day(2025, 4, 16), wantTo: day(2025, 4, 17)},
+		{arg: "TODAY", weekStart: time.Monday, wantFrom: day(2025, 4, 16), wantTo: day(2025, 4, 17)},
+		{arg: "week", weekStart: time.Monday, wantFrom: day(2025, 4, 14), wantTo: day(2025, 4, 21)},
+		{arg: "week", weekStart: time.Sunday, wantFrom: day(2025, 4, 13), wantTo: day(2025, 4, 20)},
+		{arg: "week", weekStart: time.Wednesday, wantFrom: day(2025, 4, 16), wantTo: day(2025, 4, 23)},
+		{arg: "week", weekStart: time.Thursday, wantFrom: day(2025, 4, 10), wantTo: day(2025, 4, 17)},
+		{arg: "month", weekStart: time.Monday, wantFrom: day(2025, 4, 1), wantTo: day(2025, 5, 1)},
+		{arg: "2025-03-01..2025-03-31", wantFrom: day(2025, 3, 1), wantTo: day(2025, 4, 1)},
+		{arg: "2025-03-01..2025-03-01", wantFrom: day(2025, 3, 1), wantTo: day(2025, 3, 2)},
+		{arg: "2025-03-31..2025-03-01", wantErr: true},
+		{arg: "2025-03-01..", wantErr: true},
+		{arg: "2025-3-1..2025-03-31", wantErr: true},
+		{arg: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg+" "+tt.weekStart.String(), func(t *testing.T) {
+			period, _, err := parsePeriod(tt.arg, now, tt.weekStart)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tt.wantFrom.Equal(period.From), "from %s", period.From)
+			assert.True(t, tt.wantTo.Equal(period.To), "to %s", period.To)
+		})
+	}
+}
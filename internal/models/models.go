@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"example.com/bot/pkg/todoist"
 )
 
 type TgUser struct {
@@ -10,19 +12,70 @@ type TgUser struct {
 	Name   string
 }
 
-type Token struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-}
-
 type TaskShow struct {
 	Task      string
 	TimeSpent int64
 }
 
+// StatGroup is the time spent on all tasks sharing a project, label or priority.
+type StatGroup struct {
+	Name      string
+	TimeSpent int64
+}
+
+// StatsGrouping selects the dimension grouped stats are aggregated by.
+type StatsGrouping string
+
+const (
+	StatsByProject  StatsGrouping = "project"
+	StatsByLabel    StatsGrouping = "label"
+	StatsByPriority StatsGrouping = "priority"
+)
+
+// Period limits stats to entries tracked in [From, To). Zero bounds are open.
+type Period struct {
+	From time.Time
+	To   time.Time
+}
+
+// ChatSettings are the preferences that shape how a chat's stats are computed.
+type ChatSettings struct {
+	// WeekStart is the first day of the week, taken from the Todoist profile.
+	WeekStart time.Weekday
+	// Location is the /timezone override or else the Todoist profile timezone. Day and
+	// week boundaries are taken in it.
+	Location *time.Location
+	// WriteBack is what is written to the Todoist task once its time is tracked.
+	WriteBack WriteBackMode
+}
+
+// WriteBackMode selects what is written to a Todoist task once its time is tracked.
+type WriteBackMode string
+
+const (
+	WriteBackOff WriteBackMode = "off"
+	// WriteBackComment posts a comment with the tracked time.
+	WriteBackComment WriteBackMode = "comment"
+	// WriteBackDuration posts the comment and also sets the task's duration.
+	WriteBackDuration WriteBackMode = "duration"
+)
+
+// Timer is the running timer of a chat. TaskID is empty for tasks that are not in Todoist.
+type Timer struct {
+	TaskID    string
+	Task      string
+	ProjectID string
+	SectionID string
+	Labels    []string
+	Priority  int
+	StartedAt time.Time
+}
+
 type AuthNotification struct {
 	ChatID     int64
 	Successful bool
+	// LinkedElsewhere is set when the account is already linked to another chat
+	LinkedElsewhere bool
 	// TODO :: add error to make user know what happend in bad notification
 }
 
@@ -36,39 +89,35 @@ type WebHookRequest struct {
 	EventDataExtra json.RawMessage `json:"event_data_extra"` // Use `interface{}` if the structure of event_data_extra is dynamic
 }
 
-type Task struct {
-	ID             string    `json:"id"`
-	UserID         string    `json:"user_id"`
-	ProjectID      string    `json:"project_id"`
-	Content        string    `json:"content"`
-	Description    string    `json:"description"`
-	Priority       int       `json:"priority"`
-	Due            any       `json:"due"`
-	Deadline       any       `json:"deadline"`
-	ParentID       any       `json:"parent_id"`
-	ChildOrder     int       `json:"child_order"`
-	SectionID      string    `json:"section_id"`
-	DayOrder       int       `json:"day_order"`
-	Collapsed      bool      `json:"collapsed"`
-	Labels         []string  `json:"labels"`
-	AddedByUID     string    `json:"added_by_uid"`
-	AssignedByUID  string    `json:"assigned_by_uid"`
-	ResponsibleUID any       `json:"responsible_uid"`
-	Checked        bool      `json:"checked"`
-	IsDeleted      bool      `json:"is_deleted"`
-	AddedAt        time.Time `json:"added_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	CompletedAt    any       `json:"completed_at"`
-	// TODO :: is pointer to structure correct in json umnmarshaling
-	Duration *Duration `json:"duration"`
+// InboxItem is a webhook body waiting in the inbox for processing.
+type InboxItem struct {
+	ID       int64
+	Payload  json.RawMessage
+	Attempts int
 }
 
 // TODO :: rename
 type WebHookParsed struct {
 	UserID    string
+	ChatID    int64
+	TaskID    string
 	Task      string
 	TimeSpent uint32
 	AskTime   bool
+	// Reverted is set when the time was taken back because the task was uncompleted.
+	Reverted bool
+	// TimerStarted is set when a timer was started for the task from Todoist.
+	TimerStarted bool
+	// TimerStopped is set when the time was measured by a timer stopped from Todoist.
+	TimerStopped bool
+	// EventKey identifies the completion the time belongs to, so it is only counted once.
+	EventKey string
+
+	ProjectID   string
+	SectionID   string
+	Labels      []string
+	Priority    int
+	CompletedAt *time.Time
 }
 
 type Initiator struct {
@@ -79,11 +128,6 @@ type Initiator struct {
 	IsPremium bool   `json:"is_premium"`
 }
 
-type Duration struct {
-	Amount int    `json:"amount"`
-	Unit   string `json:"unit"`
-}
-
 // probably unneeded
 type UpdateItemRequest struct {
 	ID             string                 `json:"id"`
@@ -100,68 +144,13 @@ type UpdateItemRequest struct {
 	Duration       map[string]interface{} `json:"duration"` // Use map[string]interface{} if the structure is dynamic
 }
 
-type InitSyncReq struct {
-	FullSync      bool        `json:"full_sync"`
-	SyncToken     string      `json:"sync_token"`
-	TempIDMapping interface{} `json:"temp_id_mapping"`
-	User          SyncUser    `json:"user"`
-}
-
-type SyncUser struct {
-	ActivatedUser     bool   `json:"activated_user"`
-	AutoReminder      int    `json:"auto_reminder"`
-	AvatarBig         string `json:"avatar_big"`
-	AvatarMedium      string `json:"avatar_medium"`
-	AvatarS640        string `json:"avatar_s640"`
-	AvatarSmall       string `json:"avatar_small"`
-	BusinessAccountID string `json:"business_account_id"`
-	DailyGoal         int    `json:"daily_goal"`
-	DateFormat        int    `json:"date_format"`
-	DaysOff           []int  `json:"days_off"`
-	Email             string `json:"email"`
-	FeatureIdentifier string `json:"feature_identifier"`
-	Features          struct {
-		Beta                  int  `json:"beta"`
-		DateistInlineDisabled bool `json:"dateist_inline_disabled"`
-		DateistLang           any  `json:"dateist_lang"`
-		GlobalTeams           bool `json:"global.teams"`
-		HasPushReminders      bool `json:"has_push_reminders"`
-		KarmaDisabled         bool `json:"karma_disabled"`
-		KarmaVacation         bool `json:"karma_vacation"`
-		KisaConsentTimestamp  any  `json:"kisa_consent_timestamp"`
-		Restriction           int  `json:"restriction"`
-	} `json:"features"`
-	FullName              string    `json:"full_name"`
-	HasPassword           bool      `json:"has_password"`
-	ID                    string    `json:"id"`
-	ImageID               string    `json:"image_id"`
-	InboxProjectID        string    `json:"inbox_project_id"`
-	IsCelebrationsEnabled bool      `json:"is_celebrations_enabled"`
-	IsPremium             bool      `json:"is_premium"`
-	JoinableWorkspace     any       `json:"joinable_workspace"`
-	JoinedAt              time.Time `json:"joined_at"`
-	Karma                 int       `json:"karma"`
-	KarmaTrend            string    `json:"karma_trend"`
-	Lang                  string    `json:"lang"`
-	MfaEnabled            bool      `json:"mfa_enabled"`
-	NextWeek              int       `json:"next_week"`
-	PremiumStatus         string    `json:"premium_status"`
-	PremiumUntil          any       `json:"premium_until"`
-	ShareLimit            int       `json:"share_limit"`
-	SortOrder             int       `json:"sort_order"`
-	StartDay              int       `json:"start_day"`
-	StartPage             string    `json:"start_page"`
-	ThemeID               string    `json:"theme_id"`
-	TimeFormat            int       `json:"time_format"`
-	Token                 string    `json:"token"`
-	TzInfo                struct {
-		GmtString string `json:"gmt_string"`
-		Hours     int    `json:"hours"`
-		IsDst     int    `json:"is_dst"`
-		Minutes   int    `json:"minutes"`
-		Timezone  string `json:"timezone"`
-	} `json:"tz_info"`
-	VerificationStatus string `json:"verification_status"`
-	WeekendStartDay    int    `json:"weekend_start_day"`
-	WeeklyGoal         int    `json:"weekly_goal"`
-}
+// The Todoist API types are defined with the client.
+type (
+	Token       = todoist.Token
+	Project     = todoist.Project
+	Task        = todoist.Task
+	Due         = todoist.Due
+	Duration    = todoist.Duration
+	InitSyncReq = todoist.SyncResponse
+	SyncUser    = todoist.User
+)
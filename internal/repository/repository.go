@@ -3,56 +3,37 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"example.com/bot/internal/logger"
 	"example.com/bot/internal/models"
 	"example.com/bot/pkg/tools"
+	"github.com/jackc/pgx/v5/pgtype"
 	"go.uber.org/zap"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+var (
+	// ErrNotFound is returned when a lookup matches no rows.
+	ErrNotFound = errors.New("not found")
+	// ErrExpired is returned when the looked up row is past its expiry.
+	ErrExpired = errors.New("expired")
+)
+
 type LocalStorage struct {
-	tokens        sync.Map
-	states        sync.Map
 	botUserStates sync.Map
 }
 
 func NewLocalStorage() *LocalStorage {
 	return &LocalStorage{
-		tokens:        sync.Map{},
-		states:        sync.Map{},
 		botUserStates: sync.Map{},
 	}
 }
 
-func (l *LocalStorage) StoreToken(userID, token string) {
-	l.tokens.Store(userID, token)
-}
-
-func (l *LocalStorage) GetToken(userID string) string {
-	val, ok := l.tokens.Load(userID)
-	if !ok {
-		return ""
-	}
-	return val.(string)
-}
-
-func (l *LocalStorage) StoreState(state string, chatID int) {
-	l.states.Store(state, chatID)
-	// l.states.
-}
-
-func (l *LocalStorage) GetChatID(state string) int {
-	val, loaded := l.states.LoadAndDelete(state)
-	if !loaded {
-		return -1
-	}
-	return val.(int)
-}
-
 func (l *LocalStorage) SetStatus(chatID int64, status int) {
 	l.botUserStates.Store(chatID, status)
 }
@@ -111,7 +92,9 @@ func (d *Dao) CreateUser(ctx context.Context, u *models.TgUser) (bool, error) {
 	return true, nil
 }
 
-func (d *Dao) AddTodoistUser(ctx context.Context, todoistID string, userName string) error {
+// AddTodoistUser creates the Todoist user or refreshes the stored profile. startDay is
+// Todoist's first day of the week, 1 for Monday to 7 for Sunday, timezone is an IANA name.
+func (d *Dao) AddTodoistUser(ctx context.Context, todoistID string, userName string, startDay int, timezone string) error {
 	query, err := tools.LoadQuery("add_todoist_user.sql")
 	if err != nil {
 		logger.Log.Error("Error loading SQL query",
@@ -119,7 +102,7 @@ func (d *Dao) AddTodoistUser(ctx context.Context, todoistID string, userName str
 		)
 		return err
 	}
-	res, err := d.db.ExecContext(ctx, query, todoistID, userName)
+	res, err := d.db.ExecContext(ctx, query, todoistID, userName, startDay, timezone)
 	if err != nil {
 		logger.Log.Error("error in adding todoist user",
 			zap.Error(err),
@@ -173,50 +156,206 @@ func (d *Dao) AddUserId(ctx context.Context, chat_id int64, todoist_id string) e
 	return nil
 }
 
-func (d *Dao) GetChatIDByTodoist(ctx context.Context, todoistUserID string) int64 {
+func (d *Dao) GetChatIDByTodoist(ctx context.Context, todoistUserID string) (int64, error) {
 	query, err := tools.LoadQuery("get_chat_id_by_todoist_id.sql")
 	if err != nil {
-		panic(err)
-	}
-	row := d.db.QueryRowContext(ctx, query, todoistUserID)
-	if row.Err() != nil {
-		panic(row.Err())
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return 0, err
 	}
 	var chatID int64
-	err = row.Scan(&chatID)
-	if err != nil {
-		panic(err)
+	err = d.db.QueryRowContext(ctx, query, todoistUserID).Scan(&chatID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		logger.Log.Error("Error in getting chat by todoist user",
+			zap.String("todoist_id", todoistUserID),
+			zap.Error(err),
+		)
+		return 0, err
 	}
-	return chatID
+	return chatID, nil
 }
 
-func (d *Dao) StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) {
+// StoreTaskTracked records the tracked time. It returns false without changing the stats
+// when an entry with the same event key is already stored.
+func (d *Dao) StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) (bool, error) {
 	query, err := tools.LoadQuery("store_task_recording.sql")
 	if err != nil {
-		panic(err)
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return false, err
+	}
+	var stored bool
+	err = d.db.QueryRowContext(ctx, query,
+		chatID, task.TaskID, task.Task, task.TimeSpent, task.EventKey,
+		task.ProjectID, task.SectionID, task.Labels, task.Priority, task.CompletedAt,
+	).Scan(&stored)
+	if err != nil {
+		logger.Log.Error("Error in storing tracked task",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return false, err
+	}
+	return stored, nil
+}
+
+// RevertTaskTracked marks the entry of the latest completion of the Todoist task as
+// reverted and returns it. ok is false when the task has no completion or its latest one
+// is already reverted, so a repeated revert does nothing.
+func (d *Dao) RevertTaskTracked(ctx context.Context, chatID int64, taskID string) (reverted models.TaskShow, ok bool, err error) {
+	query, err := tools.LoadQuery("revert_task_recording.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return reverted, false, err
+	}
+	var content sql.NullString
+	var timeSpent sql.NullInt64
+	err = d.db.QueryRowContext(ctx, query, chatID, taskID).Scan(&content, &timeSpent)
+	if err != nil {
+		logger.Log.Error("Error in reverting tracked task",
+			zap.Int64("chat_id", chatID),
+			zap.String("task_id", taskID),
+			zap.Error(err),
+		)
+		return reverted, false, err
+	}
+	if !content.Valid {
+		return reverted, false, nil
+	}
+	reverted.Task = content.String
+	reverted.TimeSpent = timeSpent.Int64
+	return reverted, true, nil
+}
+
+// EnqueueWebHook stores a verified webhook body in the inbox, so it survives until processed.
+// Bodies whose delivery ID or event key were already seen are skipped and false is returned.
+func (d *Dao) EnqueueWebHook(ctx context.Context, payload []byte, deliveryID, eventKey string) (bool, error) {
+	query, err := tools.LoadQuery("enqueue_webhook.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return false, err
+	}
+	res, err := d.db.ExecContext(ctx, query, string(payload), deliveryID, eventKey)
+	if err != nil {
+		logger.Log.Error("Error in enqueuing webhook",
+			zap.Error(err),
+		)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("Error while checking affected rows",
+			zap.Error(err),
+		)
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ClaimWebHooks takes up to limit pending inbox rows that are due. Claimed rows are hidden
+// from other workers for lease, after which they are picked up again if not completed.
+func (d *Dao) ClaimWebHooks(ctx context.Context, limit int, lease time.Duration) ([]models.InboxItem, error) {
+	query, err := tools.LoadQuery("claim_webhooks.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	rows, err := d.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		logger.Log.Error("Error in claiming webhooks",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+	items := make([]models.InboxItem, 0, limit)
+	for rows.Next() {
+		item := models.InboxItem{}
+		var payload []byte
+		if err := rows.Scan(&item.ID, &payload, &item.Attempts); err != nil {
+			logger.Log.Error("Error in scanning claimed webhook",
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		item.Payload = payload
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (d *Dao) CompleteWebHook(ctx context.Context, id int64) error {
+	return d.execInbox(ctx, "complete_webhook.sql", id)
+}
+
+// RetryWebHook makes the inbox row available again at retryAt.
+func (d *Dao) RetryWebHook(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+	return d.execInbox(ctx, "retry_webhook.sql", id, retryAt, reason)
+}
+
+// BuryWebHook gives up on the inbox row, keeping it for inspection.
+func (d *Dao) BuryWebHook(ctx context.Context, id int64, reason string) error {
+	return d.execInbox(ctx, "bury_webhook.sql", id, reason)
+}
+
+func (d *Dao) execInbox(ctx context.Context, file string, id int64, args ...any) error {
+	query, err := tools.LoadQuery(file)
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
 	}
-	_, err = d.db.ExecContext(ctx, query, chatID, task.Task, task.TimeSpent)
+	_, err = d.db.ExecContext(ctx, query, append([]any{id}, args...)...)
 	if err != nil {
-		panic(err)
+		logger.Log.Error("Error in updating webhook inbox",
+			zap.String("query", file),
+			zap.Int64("id", id),
+			zap.Error(err),
+		)
+		return err
 	}
+	return nil
 }
 
-func (d *Dao) GetUserStats(ctx context.Context, chatID int64) (int64, []models.TaskShow) {
+// GetUserStats returns the time tracked within period in total and per task.
+func (d *Dao) GetUserStats(ctx context.Context, chatID int64, period models.Period) (int64, []models.TaskShow, error) {
 	query, err := tools.LoadQuery("get_stats.sql")
 	if err != nil {
-		panic(err)
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return 0, nil, err
 	}
-	rows, err := d.db.Query(query, chatID)
+	rows, err := d.db.QueryContext(ctx, query, chatID, nullTime(period.From), nullTime(period.To))
 	if err != nil {
-		panic(err)
+		logger.Log.Error("Error in getting stats",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return 0, nil, err
 	}
+	defer rows.Close()
 	var timeSpent int64
 	tasks := make([]models.TaskShow, 0, 100)
 	for rows.Next() {
 		tt := models.TaskShow{}
 		err = rows.Scan(&timeSpent, &tt.Task, &tt.TimeSpent)
 		if err != nil {
-			panic(err)
+			logger.Log.Error("Error in scanning stats",
+				zap.Error(err),
+			)
+			return 0, nil, err
 		}
 		tasks = append(tasks, tt)
 	}
@@ -224,7 +363,468 @@ func (d *Dao) GetUserStats(ctx context.Context, chatID int64) (int64, []models.T
 		zap.Int64("timeSpentSUm", timeSpent),
 		zap.Any("task list", tasks),
 	)
-	return timeSpent, tasks
+	return timeSpent, tasks, rows.Err()
+}
+
+// GetChatSettings returns the chat's preferences, with defaults for chats without a
+// linked Todoist account. Without any timezone the server's one is used.
+func (d *Dao) GetChatSettings(ctx context.Context, chatID int64) (models.ChatSettings, error) {
+	settings := models.ChatSettings{WeekStart: time.Monday, Location: time.Local, WriteBack: models.WriteBackOff}
+	query, err := tools.LoadQuery("get_chat_settings.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return settings, err
+	}
+	var startDay int
+	var timezone, writeBack string
+	err = d.db.QueryRowContext(ctx, query, chatID).Scan(&startDay, &timezone, &writeBack)
+	if errors.Is(err, sql.ErrNoRows) {
+		return settings, nil
+	} else if err != nil {
+		logger.Log.Error("Error in getting chat settings",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return settings, err
+	}
+	settings.WeekStart = time.Weekday(startDay % 7)
+	settings.WriteBack = models.WriteBackMode(writeBack)
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			logger.Log.Warn("Unknown timezone, using server time",
+				zap.Int64("chat_id", chatID),
+				zap.String("timezone", timezone),
+			)
+		} else {
+			settings.Location = loc
+		}
+	}
+	return settings, nil
+}
+
+// SetChatTimezone overrides the chat's timezone; an empty name goes back to the
+// Todoist profile timezone.
+func (d *Dao) SetChatTimezone(ctx context.Context, chatID int64, timezone string) error {
+	query, err := tools.LoadQuery("set_chat_timezone.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	res, err := d.db.ExecContext(ctx, query, chatID, timezone)
+	if err != nil {
+		logger.Log.Error("Error in setting chat timezone",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("Error while checking affected rows",
+			zap.Error(err),
+		)
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetChatWriteBack sets what is written to Todoist tasks tracked in the chat.
+func (d *Dao) SetChatWriteBack(ctx context.Context, chatID int64, mode models.WriteBackMode) error {
+	query, err := tools.LoadQuery("set_chat_writeback.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	res, err := d.db.ExecContext(ctx, query, chatID, string(mode))
+	if err != nil {
+		logger.Log.Error("Error in setting chat writeback",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		logger.Log.Error("Error while checking affected rows",
+			zap.Error(err),
+		)
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (d *Dao) GetTodoistUserIDs(ctx context.Context) ([]string, error) {
+	query, err := tools.LoadQuery("get_todoist_user_ids.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		logger.Log.Error("Error in getting todoist users",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			logger.Log.Error("Error in scanning todoist user",
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetSyncToken returns the sync token of the last sync of the Todoist user, or "" if the
+// user was never synced.
+func (d *Dao) GetSyncToken(ctx context.Context, todoistID string) (string, error) {
+	query, err := tools.LoadQuery("get_sync_token.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return "", err
+	}
+	var syncToken string
+	err = d.db.QueryRowContext(ctx, query, todoistID).Scan(&syncToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	} else if err != nil {
+		logger.Log.Error("Error in getting sync token",
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return "", err
+	}
+	return syncToken, nil
+}
+
+func (d *Dao) SetSyncToken(ctx context.Context, todoistID, syncToken string) error {
+	query, err := tools.LoadQuery("set_sync_token.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, query, todoistID, syncToken)
+	if err != nil {
+		logger.Log.Error("Error in setting sync token",
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+var groupedStatsQueries = map[models.StatsGrouping]string{
+	models.StatsByProject:  "get_stats_by_project.sql",
+	models.StatsByLabel:    "get_stats_by_label.sql",
+	models.StatsByPriority: "get_stats_by_priority.sql",
+}
+
+// GetGroupedStats sums the chat's time tracked within period by project, label or priority,
+// largest first. The label grouping leaves out log labels and hiddenLabels.
+func (d *Dao) GetGroupedStats(ctx context.Context, chatID int64, by models.StatsGrouping, period models.Period, hiddenLabels []string) ([]models.StatGroup, error) {
+	file, ok := groupedStatsQueries[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown stats grouping %q", by)
+	}
+	query, err := tools.LoadQuery(file)
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	args := []any{chatID, nullTime(period.From), nullTime(period.To)}
+	if by == models.StatsByLabel {
+		if hiddenLabels == nil {
+			hiddenLabels = []string{}
+		}
+		args = append(args, hiddenLabels)
+	}
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		logger.Log.Error("Error in getting grouped stats",
+			zap.String("by", string(by)),
+			zap.Error(err),
+		)
+		return nil, err
+	}
+	defer rows.Close()
+	groups := make([]models.StatGroup, 0)
+	for rows.Next() {
+		g := models.StatGroup{}
+		if err := rows.Scan(&g.Name, &g.TimeSpent); err != nil {
+			logger.Log.Error("Error in scanning grouped stats",
+				zap.Error(err),
+			)
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (d *Dao) GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error) {
+	query, err := tools.LoadQuery("get_todoist_id_by_chat_id.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return "", err
+	}
+	var todoistID string
+	err = d.db.QueryRowContext(ctx, query, chatID).Scan(&todoistID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	} else if err != nil {
+		logger.Log.Error("Error in getting todoist user by chat",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return "", err
+	}
+	return todoistID, nil
+}
+
+// StoreOAuthState remembers which chat started the OAuth flow with state. The state
+// can be taken until ttl passes.
+func (d *Dao) StoreOAuthState(ctx context.Context, state string, chatID int64, ttl time.Duration) error {
+	query, err := tools.LoadQuery("store_oauth_state.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, query, state, chatID, ttl.Seconds())
+	if err != nil {
+		logger.Log.Error("Error in storing oauth state",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// TakeOAuthState returns the chat that started the OAuth flow with state and removes the
+// state, so it can be used only once. It returns ErrNotFound for unknown states and
+// ErrExpired for expired ones.
+func (d *Dao) TakeOAuthState(ctx context.Context, state string) (int64, error) {
+	query, err := tools.LoadQuery("take_oauth_state.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return 0, err
+	}
+	var (
+		chatID  int64
+		expired bool
+	)
+	err = d.db.QueryRowContext(ctx, query, state).Scan(&chatID, &expired)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		logger.Log.Error("Error in taking oauth state",
+			zap.Error(err),
+		)
+		return 0, err
+	}
+	if expired {
+		return 0, ErrExpired
+	}
+	return chatID, nil
+}
+
+// PurgeOAuthStates removes expired states of abandoned OAuth flows.
+func (d *Dao) PurgeOAuthStates(ctx context.Context) (int64, error) {
+	query, err := tools.LoadQuery("purge_oauth_states.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return 0, err
+	}
+	res, err := d.db.ExecContext(ctx, query)
+	if err != nil {
+		logger.Log.Error("Error in purging oauth states",
+			zap.Error(err),
+		)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// UnlinkChat removes the link between the chat and the Todoist user. The user's token
+// and sync state are removed as well unless other chats are still linked to the user.
+func (d *Dao) UnlinkChat(ctx context.Context, chatID int64, todoistID string) error {
+	query, err := tools.LoadQuery("unlink_chat.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, query, chatID, todoistID)
+	if err != nil {
+		logger.Log.Error("Error in unlinking chat",
+			zap.Int64("chat_id", chatID),
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// OtherChatsLinked reports whether chats other than chatID are linked to the Todoist user.
+func (d *Dao) OtherChatsLinked(ctx context.Context, chatID int64, todoistID string) (bool, error) {
+	query, err := tools.LoadQuery("other_chats_linked.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return false, err
+	}
+	var linked bool
+	err = d.db.QueryRowContext(ctx, query, chatID, todoistID).Scan(&linked)
+	if err != nil {
+		logger.Log.Error("Error in checking linked chats",
+			zap.Int64("chat_id", chatID),
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return false, err
+	}
+	return linked, nil
+}
+
+// StartTimer starts the timer of the chat. It returns false if a timer is already running.
+func (d *Dao) StartTimer(ctx context.Context, chatID int64, timer models.Timer) (bool, error) {
+	query, err := tools.LoadQuery("start_timer.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return false, err
+	}
+	res, err := d.db.ExecContext(ctx, query,
+		chatID, timer.TaskID, timer.Task, timer.ProjectID, timer.SectionID, timer.Labels, timer.Priority, timer.StartedAt,
+	)
+	if err != nil {
+		logger.Log.Error("Error in starting timer",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return false, err
+	}
+	started, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return started == 1, nil
+}
+
+// GetTimer returns the running timer of the chat or ErrNotFound.
+func (d *Dao) GetTimer(ctx context.Context, chatID int64) (models.Timer, error) {
+	var timer models.Timer
+	query, err := tools.LoadQuery("get_timer.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return timer, err
+	}
+	err = d.db.QueryRowContext(ctx, query, chatID).Scan(
+		&timer.TaskID, &timer.Task, &timer.ProjectID, &timer.SectionID,
+		pgtype.NewMap().SQLScanner(&timer.Labels), &timer.Priority, &timer.StartedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return timer, ErrNotFound
+	} else if err != nil {
+		logger.Log.Error("Error in getting timer",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return timer, err
+	}
+	return timer, nil
+}
+
+// DeleteTimer removes the timer of the chat started at startedAt. Timers started at
+// another time are kept, so a timer started meanwhile survives.
+func (d *Dao) DeleteTimer(ctx context.Context, chatID int64, startedAt time.Time) error {
+	query, err := tools.LoadQuery("delete_timer.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	_, err = d.db.ExecContext(ctx, query, chatID, startedAt)
+	if err != nil {
+		logger.Log.Error("Error in deleting timer",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// StoreProjects saves the names of the Todoist user's projects.
+func (d *Dao) StoreProjects(ctx context.Context, todoistID string, projects []models.Project) error {
+	query, err := tools.LoadQuery("store_project.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	for _, p := range projects {
+		if _, err := d.db.ExecContext(ctx, query, p.ID, todoistID, p.Name); err != nil {
+			logger.Log.Error("Error in storing project",
+				zap.String("project_id", p.ID),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+	return nil
 }
 
 // TODO:: add error processing
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/pkg/secretbox"
+	"example.com/bot/pkg/tools"
+	"go.uber.org/zap"
+)
+
+// TokenStore keeps Todoist OAuth tokens in the database, encrypted with box.
+type TokenStore struct {
+	d   *Dao
+	box *secretbox.Box
+}
+
+func NewTokenStore(d *Dao, box *secretbox.Box) *TokenStore {
+	return &TokenStore{
+		d:   d,
+		box: box,
+	}
+}
+
+func (ts *TokenStore) StoreToken(ctx context.Context, todoistID, token string) error {
+	query, err := tools.LoadQuery("store_token.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return err
+	}
+	sealed, err := ts.box.Seal([]byte(token))
+	if err != nil {
+		logger.Log.Error("Error in encrypting token",
+			zap.Error(err),
+		)
+		return err
+	}
+	_, err = ts.d.db.ExecContext(ctx, query, todoistID, sealed)
+	if err != nil {
+		logger.Log.Error("Error in storing token",
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return err
+	}
+	return nil
+}
+
+// GetToken returns the token of the Todoist user, or ErrNotFound if there is none.
+func (ts *TokenStore) GetToken(ctx context.Context, todoistID string) (string, error) {
+	query, err := tools.LoadQuery("get_token.sql")
+	if err != nil {
+		logger.Log.Error("Error loading SQL query",
+			zap.Error(err),
+		)
+		return "", err
+	}
+	var sealed []byte
+	err = ts.d.db.QueryRowContext(ctx, query, todoistID).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	} else if err != nil {
+		logger.Log.Error("Error in getting token",
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return "", err
+	}
+	token, err := ts.box.Open(sealed)
+	if err != nil {
+		logger.Log.Error("Error in decrypting token, was the key changed?",
+			zap.String("todoist_id", todoistID),
+			zap.Error(err),
+		)
+		return "", err
+	}
+	return string(token), nil
+}
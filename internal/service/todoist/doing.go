@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"example.com/bot/pkg/todoist"
+	"go.uber.org/zap"
+)
+
+// TaskSource reads the current state of a Todoist task of a chat.
+type TaskSource interface {
+	Task(ctx context.Context, chatID int64, taskID string) (models.Task, error)
+}
+
+// updatedExtra is the event_data_extra of item:updated events, with the task as it was
+// before the update.
+type updatedExtra struct {
+	OldItem *models.Task `json:"old_item"`
+}
+
+// DoingLabel turns a Todoist label into a timer switch: adding the label to a task
+// starts its timer and removing it stops the timer. Completing the task stops the timer
+// through the completion webhook.
+type DoingLabel struct {
+	label  string
+	wh     *WebHookHandler
+	timers *Timers
+	tasks  TaskSource
+}
+
+// NewDoingLabel returns the item:updated handler for label. Timer changes are sent to
+// the bot through wh, and tasks is asked whether a task still has the label before its
+// timer is started.
+func NewDoingLabel(label string, wh *WebHookHandler, timers *Timers, tasks TaskSource) *DoingLabel {
+	return &DoingLabel{
+		label:  label,
+		wh:     wh,
+		timers: timers,
+		tasks:  tasks,
+	}
+}
+
+// HandleEvent starts or stops the timer of the updated task when the label was added
+// to or removed from it.
+func (dl *DoingLabel) HandleEvent(ctx context.Context, req *models.WebHookRequest) error {
+	task := &models.Task{}
+	if err := json.Unmarshal(req.EventData, task); err != nil {
+		logger.Log.Error("error in unmarshaling",
+			zap.Error(err),
+		)
+		return err
+	}
+	extra := updatedExtra{}
+	if len(req.EventDataExtra) > 0 {
+		if err := json.Unmarshal(req.EventDataExtra, &extra); err != nil {
+			logger.Log.Error("error in unmarshaling",
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+	if extra.OldItem == nil {
+		logger.Log.Debug("Updated task without old item",
+			zap.String("task_id", task.ID),
+		)
+		return nil
+	}
+	had := slices.Contains(extra.OldItem.Labels, dl.label)
+	has := slices.Contains(task.Labels, dl.label)
+	// completed tasks are stopped by their item:completed event
+	if had == has || task.Checked {
+		return nil
+	}
+
+	chatID, ok, err := dl.wh.chatID(ctx, req.UserID)
+	if !ok {
+		return err
+	}
+	wp := models.WebHookParsed{
+		UserID:    req.UserID,
+		ChatID:    chatID,
+		TaskID:    task.ID,
+		Task:      task.Content,
+		ProjectID: task.ProjectID,
+		SectionID: task.SectionID,
+		Labels:    task.Labels,
+		Priority:  task.Priority,
+	}
+	if has {
+		doing, err := dl.stillDoing(ctx, chatID, task.ID)
+		if !doing {
+			return err
+		}
+		return dl.start(ctx, wp)
+	}
+	tracked, ok, err := dl.timers.StopTask(ctx, wp)
+	if !ok {
+		return err
+	}
+	if tracked.TimerStopped {
+		dl.notify(ctx, tracked)
+	}
+	return nil
+}
+
+// stillDoing reports whether the task has the label now. Updates can be retried after
+// later ones, so an update that added the label may arrive after the label was removed
+// again; the timer it would start would never be stopped.
+func (dl *DoingLabel) stillDoing(ctx context.Context, chatID int64, taskID string) (bool, error) {
+	current, err := dl.tasks.Task(ctx, chatID, taskID)
+	var apiErr *todoist.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		logger.Log.Debug("Labeled task is gone",
+			zap.String("task_id", taskID),
+		)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if current.Checked || !slices.Contains(current.Labels, dl.label) {
+		logger.Log.Debug("Stale label update dropped",
+			zap.String("task_id", taskID),
+		)
+		return false, nil
+	}
+	return true, nil
+}
+
+// start starts the timer of the task. A timer running for another task is stopped
+// first, so moving the label from task to task switches the timer.
+func (dl *DoingLabel) start(ctx context.Context, wp models.WebHookParsed) error {
+	timer := models.Timer{
+		TaskID:    wp.TaskID,
+		Task:      wp.Task,
+		ProjectID: wp.ProjectID,
+		SectionID: wp.SectionID,
+		Labels:    wp.Labels,
+		Priority:  wp.Priority,
+	}
+	running, started, err := dl.timers.Start(ctx, wp.ChatID, timer)
+	if err != nil {
+		return err
+	}
+	if !started {
+		if running.TaskID == wp.TaskID {
+			// a redelivery of the update that started it
+			return nil
+		}
+		stopped, err := dl.timers.Stop(ctx, wp.ChatID)
+		if err != nil {
+			return err
+		}
+		if stopped.TimerStopped {
+			dl.notify(ctx, stopped)
+		}
+		if _, started, err = dl.timers.Start(ctx, wp.ChatID, timer); err != nil || !started {
+			return err
+		}
+	}
+	wp.TimerStarted = true
+	dl.notify(ctx, wp)
+	return nil
+}
+
+func (dl *DoingLabel) notify(ctx context.Context, wp models.WebHookParsed) {
+	if err := dl.wh.notify(ctx, wp); err != nil {
+		logger.Log.Warn("Timer notification dropped",
+			zap.Int64("chat_id", wp.ChatID),
+			zap.Error(err),
+		)
+	}
+}
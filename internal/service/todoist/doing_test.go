@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/todoist"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTaskSource holds the tasks as they are in Todoist now.
+type fakeTaskSource struct {
+	mu    sync.Mutex
+	tasks map[string]models.Task
+}
+
+func newFakeTaskSource() *fakeTaskSource {
+	return &fakeTaskSource{tasks: make(map[string]models.Task)}
+}
+
+func (f *fakeTaskSource) set(task models.Task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tasks[task.ID] = task
+}
+
+func (f *fakeTaskSource) Task(ctx context.Context, chatID int64, taskID string) (models.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	task, ok := f.tasks[taskID]
+	if !ok {
+		return models.Task{}, &todoist.APIError{StatusCode: http.StatusNotFound}
+	}
+	return task, nil
+}
+
+func createUpdateRequest(old, task models.Task) *models.WebHookRequest {
+	req := createWebhookRequest("item:updated", "user123", task)
+	req.EventDataExtra, _ = json.Marshal(map[string]any{"old_item": old, "update_intent": "item_updated"})
+	return req
+}
+
+func TestDoingLabel(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+	updates := make(chan models.WebHookParsed, 4)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, timers)
+	tasks := newFakeTaskSource()
+	wh.Router().Register("item:updated", NewDoingLabel("doing", wh, timers, tasks))
+
+	report := models.Task{ID: "task1", Content: "Write report", ProjectID: "project1", Labels: []string{"work"}}
+	doingReport := report
+	doingReport.Labels = []string{"work", "doing"}
+
+	// other updates leave the timer alone
+	renamed := report
+	renamed.Content = "Write the report"
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(report, renamed)))
+	assert.NoError(t, wh.processWebHook(ctx, createWebhookRequest("item:updated", "user123", doingReport)))
+	assert.Empty(t, updates)
+
+	tasks.set(doingReport)
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(report, doingReport)))
+	output := <-updates
+	assert.True(t, output.TimerStarted)
+	assert.Equal(t, "Write report", output.Task)
+	timer, err := timers.Status(ctx, testChatID)
+	assert.NoError(t, err)
+	assert.Equal(t, "task1", timer.TaskID)
+	assert.Equal(t, "project1", timer.ProjectID)
+
+	// a redelivery does not restart it
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(report, doingReport)))
+	assert.Empty(t, updates)
+
+	// the label on another task switches the timer
+	now = now.Add(15 * time.Minute)
+	call := models.Task{ID: "task2", Content: "Call Alice"}
+	doingCall := call
+	doingCall.Labels = []string{"doing"}
+	tasks.set(doingCall)
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(call, doingCall)))
+	output = <-updates
+	assert.True(t, output.TimerStopped)
+	assert.Equal(t, "task1", output.TaskID)
+	assert.Equal(t, uint32(20), output.TimeSpent)
+	output = <-updates
+	assert.True(t, output.TimerStarted)
+	assert.Equal(t, "task2", output.TaskID)
+
+	// removing the label from a task without the timer does nothing
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(doingReport, report)))
+	assert.Empty(t, updates)
+
+	now = now.Add(30 * time.Minute)
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(doingCall, call)))
+	output = <-updates
+	assert.True(t, output.TimerStopped)
+	assert.Equal(t, "task2", output.TaskID)
+	assert.Equal(t, uint32(30), output.TimeSpent)
+	assert.Nil(t, output.CompletedAt)
+	assert.Len(t, repo.tracked, 2)
+
+	_, err = timers.Status(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestDoingLabel_completion(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+	updates := make(chan models.WebHookParsed, 4)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, timers)
+	tasks := newFakeTaskSource()
+	wh.Router().Register("item:updated", NewDoingLabel("doing", wh, timers, tasks))
+
+	task := models.Task{ID: "task1", Content: "Write report"}
+	doing := task
+	doing.Labels = []string{"doing"}
+	tasks.set(doing)
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(task, doing)))
+	assert.True(t, (<-updates).TimerStarted)
+
+	// the update of a completed task is left to its completion event, even if it drops
+	// the label
+	now = now.Add(40 * time.Minute)
+	completedAt := now
+	done := doing
+	done.Checked = true
+	done.CompletedAt = &completedAt
+	undone := done
+	undone.Labels = nil
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(doing, undone)))
+	assert.Empty(t, updates)
+
+	assert.NoError(t, wh.processWebHook(ctx, createWebhookRequest("item:completed", "user123", done)))
+	output := <-updates
+	assert.True(t, output.TimerStopped)
+	assert.Equal(t, uint32(40), output.TimeSpent)
+	assert.Equal(t, completedAt, *output.CompletedAt)
+}
+
+func TestDoingLabel_staleUpdate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+	updates := make(chan models.WebHookParsed, 4)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, timers)
+	tasks := newFakeTaskSource()
+	wh.Router().Register("item:updated", NewDoingLabel("doing", wh, timers, tasks))
+
+	task := models.Task{ID: "task1", Content: "Write report"}
+	doing := task
+	doing.Labels = []string{"doing"}
+
+	// the label was added and removed again before the retry of the update adding it
+	tasks.set(task)
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(task, doing)))
+	assert.Empty(t, updates)
+	_, err := timers.Status(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	// nor is a timer started for a task that is gone
+	assert.NoError(t, wh.processWebHook(ctx, createUpdateRequest(models.Task{ID: "task2"}, models.Task{ID: "task2", Labels: []string{"doing"}})))
+	assert.Empty(t, updates)
+	_, err = timers.Status(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
@@ -0,0 +1,386 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/authlink"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAuthToStatsFlow links a chat through the OAuth flow against a fake Todoist, then
+// completes a task there and checks that its time ends up in the chat's stats.
+func TestAuthToStatsFlow(t *testing.T) {
+	client, fake := newTestClient(t)
+	user := models.SyncUser{ID: "user123", FullName: "Test User", StartDay: 1}
+	user.TzInfo.Timezone = "Europe/Berlin"
+	fake.SetSync(models.InitSyncReq{User: user})
+
+	repo := newFlowRepository()
+	tokens := &fakeTokens{tokens: make(map[string]string)}
+	notifications := make(chan models.AuthNotification, 1)
+	updates := make(chan models.WebHookParsed, 1)
+	links := authlink.New([]byte("link-secret"), time.Minute)
+	ah := NewAuthHandler(testClientID, fake.AuthURL(), client, "test_bot", notifications, repo, tokens, links)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
+	srv := httptest.NewServer(NewService(ah, wh).routes())
+	defer srv.Close()
+	fake.SetCallback(srv.URL + "/auth/callback")
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(srv.URL + "/auth?token=" + links.Sign(testChatID, time.Now()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(page))
+	assert.Equal(t, "/auth/auth_finish", resp.Request.URL.Path)
+	assert.Contains(t, string(page), "https://t.me/test_bot")
+
+	select {
+	case n := <-notifications:
+		assert.Equal(t, models.AuthNotification{ChatID: testChatID, Successful: true}, n)
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for auth notification")
+	}
+	assert.Equal(t, "user123", repo.links[testChatID])
+	assert.Equal(t, "Europe/Berlin", repo.users["user123"].TzInfo.Timezone)
+	assert.Equal(t, fake.Tokens(), []string{tokens.tokens["user123"]})
+
+	completedAt := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	resp, err = fake.SendWebhook(srv.URL+"/webhook", createWebhookRequestRaw("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Write report",
+		Labels:      []string{"log0130"},
+		CompletedAt: &completedAt,
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if !assert.Len(t, repo.enqueued, 1) {
+		return
+	}
+
+	wh.processInboxItem(context.Background(), models.InboxItem{ID: 1, Payload: repo.enqueued[0], Attempts: 1})
+	assert.True(t, repo.completed[1])
+	select {
+	case wp := <-updates:
+		assert.Equal(t, testChatID, wp.ChatID)
+		assert.Equal(t, "Write report", wp.Task)
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for tracked task notification")
+	}
+	assert.Equal(t, int64(90), repo.statsTotal(testChatID))
+
+	// the link is used up once the account is linked
+	resp, err = browser.Get(srv.URL + "/auth/callback?state=unknown")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+// TestAuthFlow_storeFailure checks that a chat is not told it is linked when the
+// account could not be stored.
+func TestAuthFlow_storeFailure(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.SetSync(models.InitSyncReq{User: models.SyncUser{ID: "user123", FullName: "Test User"}})
+
+	repo := newFlowRepository()
+	tokens := &fakeTokens{tokens: make(map[string]string), storeErr: errors.New("encryption failed")}
+	notifications := make(chan models.AuthNotification, 1)
+	links := authlink.New([]byte("link-secret"), time.Minute)
+	ah := NewAuthHandler(testClientID, fake.AuthURL(), client, "test_bot", notifications, repo, tokens, links)
+	wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+	srv := httptest.NewServer(NewService(ah, wh).routes())
+	defer srv.Close()
+	fake.SetCallback(srv.URL + "/auth/callback")
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(srv.URL + "/auth?token=" + links.Sign(testChatID, time.Now()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "/auth/callback", resp.Request.URL.Path)
+
+	select {
+	case n := <-notifications:
+		assert.Equal(t, models.AuthNotification{ChatID: testChatID, Successful: false}, n)
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for auth notification")
+	}
+	assert.Empty(t, repo.links)
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	tests := []struct {
+		name string
+		// auths are the chats that link the account through the OAuth flow, in order
+		auths []int64
+		// shared are other chats linked to the same account by older versions, which
+		// did not refuse a second chat
+		shared      []int64
+		wantRevoked bool
+	}{
+		{
+			name:        "One chat",
+			auths:       []int64{testChatID},
+			wantRevoked: true,
+		},
+		{
+			name:        "Linked twice from the same chat",
+			auths:       []int64{testChatID, testChatID},
+			wantRevoked: true,
+		},
+		{
+			name:   "Account shared with another chat",
+			auths:  []int64{testChatID},
+			shared: []int64{testChatID + 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.SetSync(models.InitSyncReq{User: models.SyncUser{ID: "user123", FullName: "Test User"}})
+			repo := newFlowRepository()
+			tokens := &fakeTokens{tokens: make(map[string]string)}
+			notifications := make(chan models.AuthNotification, 1)
+			links := authlink.New([]byte("link-secret"), time.Minute)
+			ah := NewAuthHandler(testClientID, fake.AuthURL(), client, "test_bot", notifications, repo, tokens, links)
+			wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+			srv := httptest.NewServer(NewService(ah, wh).routes())
+			defer srv.Close()
+			fake.SetCallback(srv.URL + "/auth/callback")
+
+			for _, chatID := range tt.auths {
+				n := linkChat(t, srv.URL, links, chatID, notifications)
+				assert.True(t, n.Successful)
+			}
+			for _, chatID := range tt.shared {
+				repo.links[chatID] = "user123"
+			}
+			token := tokens.tokens["user123"]
+
+			assert.NoError(t, ah.Logout(context.Background(), testChatID))
+			_, linked := repo.links[testChatID]
+			assert.False(t, linked)
+			assert.Equal(t, !tt.wantRevoked, slices.Contains(fake.Tokens(), token))
+			for _, chatID := range tt.shared {
+				assert.Equal(t, "user123", repo.links[chatID], "other chats stay linked")
+			}
+
+			assert.ErrorIs(t, ah.Logout(context.Background(), testChatID), repository.ErrNotFound)
+		})
+	}
+}
+
+// TestAuthFlow_linkedElsewhere checks that an account linked to a chat is not linked to
+// another one, whose events would be sent to only one of them.
+func TestAuthFlow_linkedElsewhere(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.SetSync(models.InitSyncReq{User: models.SyncUser{ID: "user123", FullName: "Test User"}})
+	repo := newFlowRepository()
+	tokens := &fakeTokens{tokens: make(map[string]string)}
+	notifications := make(chan models.AuthNotification, 1)
+	links := authlink.New([]byte("link-secret"), time.Minute)
+	ah := NewAuthHandler(testClientID, fake.AuthURL(), client, "test_bot", notifications, repo, tokens, links)
+	wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+	srv := httptest.NewServer(NewService(ah, wh).routes())
+	defer srv.Close()
+	fake.SetCallback(srv.URL + "/auth/callback")
+
+	assert.True(t, linkChat(t, srv.URL, links, testChatID, notifications).Successful)
+	token := tokens.tokens["user123"]
+
+	n := linkChat(t, srv.URL, links, testChatID+1, notifications)
+	assert.Equal(t, models.AuthNotification{ChatID: testChatID + 1, LinkedElsewhere: true}, n)
+	assert.Equal(t, map[int64]string{testChatID: "user123"}, repo.links)
+	assert.Equal(t, token, tokens.tokens["user123"], "the token of the linked chat is kept")
+
+	chatID, err := wh.r.GetChatIDByTodoist(context.Background(), "user123")
+	assert.NoError(t, err)
+	assert.Equal(t, testChatID, chatID)
+
+	// linking the same chat again is fine
+	assert.True(t, linkChat(t, srv.URL, links, testChatID, notifications).Successful)
+}
+
+// linkChat goes through the OAuth flow for the chat and returns the notification sent
+// to the bot.
+func linkChat(t *testing.T, srv string, links *authlink.Signer, chatID int64, notifications <-chan models.AuthNotification) models.AuthNotification {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(srv + "/auth?token=" + links.Sign(chatID, time.Now()))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	select {
+	case n := <-notifications:
+		assert.Equal(t, chatID, n.ChatID)
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for auth notification")
+		return models.AuthNotification{}
+	}
+}
+
+// flowRepository links chats through the auth flow instead of mapping every
+// Todoist user to testChatID.
+type flowRepository struct {
+	*fakeRepository
+
+	authMu sync.Mutex
+	states map[string]int64
+	users  map[string]models.SyncUser
+	// links maps a chat to its Todoist user; several chats may share a user
+	links map[int64]string
+}
+
+func newFlowRepository() *flowRepository {
+	return &flowRepository{
+		fakeRepository: newFakeRepository(),
+		states:         make(map[string]int64),
+		users:          make(map[string]models.SyncUser),
+		links:          make(map[int64]string),
+	}
+}
+
+func (f *flowRepository) StoreOAuthState(ctx context.Context, state string, chatID int64, ttl time.Duration) error {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	f.states[state] = chatID
+	return nil
+}
+
+func (f *flowRepository) TakeOAuthState(ctx context.Context, state string) (int64, error) {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	chatID, ok := f.states[state]
+	if !ok {
+		return 0, repository.ErrNotFound
+	}
+	delete(f.states, state)
+	return chatID, nil
+}
+
+func (f *flowRepository) PurgeOAuthStates(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (f *flowRepository) AddTodoistUser(ctx context.Context, todoistID string, userName string, startDay int, timezone string) error {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	user := models.SyncUser{ID: todoistID, FullName: userName, StartDay: startDay}
+	user.TzInfo.Timezone = timezone
+	f.users[todoistID] = user
+	return nil
+}
+
+func (f *flowRepository) AddUserId(ctx context.Context, chatID int64, todoistID string) error {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	f.links[chatID] = todoistID
+	return nil
+}
+
+func (f *flowRepository) GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error) {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	todoistID, ok := f.links[chatID]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return todoistID, nil
+}
+
+func (f *flowRepository) OtherChatsLinked(ctx context.Context, chatID int64, todoistID string) (bool, error) {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	for linked, id := range f.links {
+		if id == todoistID && linked != chatID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *flowRepository) UnlinkChat(ctx context.Context, chatID int64, todoistID string) error {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	delete(f.links, chatID)
+	return nil
+}
+
+func (f *flowRepository) GetChatIDByTodoist(ctx context.Context, todoistUserID string) (int64, error) {
+	f.authMu.Lock()
+	defer f.authMu.Unlock()
+	found := false
+	var chatID int64
+	for linked, id := range f.links {
+		if id == todoistUserID && (!found || linked < chatID) {
+			chatID, found = linked, true
+		}
+	}
+	if !found {
+		return 0, repository.ErrNotFound
+	}
+	return chatID, nil
+}
+
+// statsTotal is the time tracked for the chat, as /stats would show it.
+func (f *flowRepository) statsTotal(chatID int64) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var total int64
+	for _, t := range f.tracked {
+		if t.ChatID == chatID && !f.reverted[t.EventKey] {
+			total += int64(t.TimeSpent)
+		}
+	}
+	return total
+}
+
+type fakeTokens struct {
+	mu       sync.Mutex
+	tokens   map[string]string
+	storeErr error
+}
+
+func (f *fakeTokens) StoreToken(ctx context.Context, todoistID, token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.storeErr != nil {
+		return f.storeErr
+	}
+	f.tokens[todoistID] = token
+	return nil
+}
+
+func (f *fakeTokens) GetToken(ctx context.Context, todoistID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	token, ok := f.tokens[todoistID]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return token, nil
+}
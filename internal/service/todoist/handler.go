@@ -4,41 +4,66 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"html"
 	"net/http"
 	"net/url"
-	"strconv"
 	"sync"
+	"time"
 
 	"example.com/bot/internal/logger"
 	"example.com/bot/internal/models"
 	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/authlink"
+	"example.com/bot/pkg/todoist"
 	"go.uber.org/zap"
 )
 
-const (
-	baseAuthURL     = "https://todoist.com/oauth/authorize"
-	baseTokenGetURL = "https://todoist.com/oauth/access_token"
-	SyncURL         = "https://api.todoist.com/api/v1/sync?sync_token=*&resource_types=[\"user\"]"
-)
+var errLinkedElsewhere = errors.New("todoist account is linked to another chat")
+
+// AuthRepository is the storage used by the OAuth flow and logout.
+type AuthRepository interface {
+	StoreOAuthState(ctx context.Context, state string, chatID int64, ttl time.Duration) error
+	TakeOAuthState(ctx context.Context, state string) (int64, error)
+	PurgeOAuthStates(ctx context.Context) (int64, error)
+	AddTodoistUser(ctx context.Context, todoistID string, userName string, startDay int, timezone string) error
+	AddUserId(ctx context.Context, chatID int64, todoistID string) error
+	GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error)
+	GetChatIDByTodoist(ctx context.Context, todoistUserID string) (int64, error)
+	OtherChatsLinked(ctx context.Context, chatID int64, todoistID string) (bool, error)
+	UnlinkChat(ctx context.Context, chatID int64, todoistID string) error
+}
+
+// TokenStorage keeps the Todoist tokens of linked accounts.
+type TokenStorage interface {
+	StoreToken(ctx context.Context, todoistID, token string) error
+	GetToken(ctx context.Context, todoistID string) (string, error)
+}
 
 type AuthHandler struct {
-	queryParams url.Values
+	clientID string
+	authURL  string
+	client   *todoist.Client
+	botURL   string
 
 	botNotifier chan<- models.AuthNotification
-	r           *repository.Dao
-	storage     *repository.LocalStorage
+	r           AuthRepository
+	tokens      TokenStorage
+	links       *authlink.Signer
 }
 
-func NewAuthHandler(clientID, clientSecret string, botNotificatioinsChan chan<- models.AuthNotification, r *repository.Dao, storage *repository.LocalStorage) *AuthHandler {
+// NewAuthHandler returns the handler of the OAuth flow. authURL is the Todoist
+// authorization page the user is sent to.
+func NewAuthHandler(clientID, authURL string, client *todoist.Client, botUsername string, botNotificatioinsChan chan<- models.AuthNotification, r AuthRepository, tokens TokenStorage, links *authlink.Signer) *AuthHandler {
 	return &AuthHandler{
-		queryParams: url.Values{
-			"client_id":     {clientID},
-			"client_secret": {clientSecret},
-		},
+		clientID:    clientID,
+		authURL:     authURL,
+		client:      client,
+		botURL:      "https://t.me/" + botUsername,
 		botNotifier: botNotificatioinsChan,
 		r:           r,
-		storage:     storage,
+		tokens:      tokens,
+		links:       links,
 	}
 }
 
@@ -52,9 +77,12 @@ func genRandomState() (string, error) {
 }
 
 func (ah *AuthHandler) handleOAuth(w http.ResponseWriter, r *http.Request) {
-	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	chatID, err := ah.links.Verify(r.URL.Query().Get("token"), time.Now())
+	if errors.Is(err, authlink.ErrExpired) {
+		http.Error(w, "Authorization link expired, request a new one with /auth in the bot", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Invalid authorization link, request a new one with /auth in the bot", http.StatusBadRequest)
 		return
 	}
 	state, err := genRandomState()
@@ -66,7 +94,7 @@ func (ah *AuthHandler) handleOAuth(w http.ResponseWriter, r *http.Request) {
 
 	logger.Log.Debug("state & chat_id",
 		zap.String("state", state),
-		zap.Int("chatID", chatID),
+		zap.Int64("chatID", chatID),
 	)
 
 	// TODO :: try to set cookie httponly, secure
@@ -74,27 +102,25 @@ func (ah *AuthHandler) handleOAuth(w http.ResponseWriter, r *http.Request) {
 		Name:   "oauth_state",
 		Value:  state,
 		Path:   "/",
-		MaxAge: 300,
+		MaxAge: int(stateTTL.Seconds()),
 		// HttpOnly: true,
 		// Secure: true,
 	})
 	logger.Log.Debug("set cookie")
 
-	if ah.storage == nil {
-		panic("storage is nill")
+	if err := ah.r.StoreOAuthState(r.Context(), state, chatID, stateTTL); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	ah.storage.StoreState(state, chatID)
-
 	logger.Log.Debug("state stored")
 
-	authLink := baseAuthURL + "?" + ah.queryParams.Encode() + "&scope=data:read_write,data:delete" + "&state=" + state
-
-	queryParams := ah.queryParams
-	queryParams.Add("scope", "scope=data:read_write,data:delete")
-	queryParams.Add("state", state)
-
-	// authLink := baseAuthURL + "?" + queryParams.Encode()
+	// the link is opened in the browser, so it must not carry the client secret
+	authLink := ah.authURL + "?" + url.Values{
+		"client_id": {ah.clientID},
+		"scope":     {"data:read_write,data:delete"},
+		"state":     {state},
+	}.Encode()
 
 	logger.Log.Debug("Auth url",
 		zap.String("URL", authLink),
@@ -116,83 +142,105 @@ func (ah *AuthHandler) handleCode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	code := r.URL.Query().Get("code")
-
-	queryParams := ah.queryParams
-	queryParams.Add("code", code)
-
-	url := baseTokenGetURL + "?" + queryParams.Encode()
+	chatID, err := ah.r.TakeOAuthState(r.Context(), state)
+	switch {
+	case errors.Is(err, repository.ErrExpired):
+		http.Error(w, "Authorization link expired, request a new one with /auth in the bot", http.StatusBadRequest)
+		return
+	case errors.Is(err, repository.ErrNotFound):
+		http.Error(w, "Unknown authorization state, request a new link with /auth in the bot", http.StatusBadRequest)
+		return
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	resp, err := http.Post(url, "", nil)
+	code := r.URL.Query().Get("code")
+	token, err := ah.client.ExchangeToken(r.Context(), code)
 	if err != nil {
-		panic(err)
-	}
-	req := models.Token{}
-	defer resp.Body.Close()
-	if err := json.NewDecoder(resp.Body).Decode(&req); err != nil {
-		// rBytes, _ := io.ReadAll(r.Body)
-		// log.Fatalf("unexpected req body: %s\n", string(rBytes))
-		w.WriteHeader(http.StatusBadRequest)
+		logger.Log.Error("Error in exchanging oauth code",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		http.Error(w, "Failed to get access to Todoist, request a new link with /auth in the bot", http.StatusBadGateway)
 		return
 	}
 
-	id, name, err := getUserID(req.AccessToken)
-	logger.Log.Debug("data",
-		zap.String("todoist_id", id),
-		zap.String("todoist_name", name),
-	)
+	user, err := ah.client.GetUser(r.Context(), token.AccessToken)
 	if err != nil {
-		panic(err)
+		logger.Log.Error("Error in getting todoist user",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+		http.Error(w, "Failed to get your Todoist profile, request a new link with /auth in the bot", http.StatusBadGateway)
+		return
 	}
+	logger.Log.Debug("data",
+		zap.String("todoist_id", user.ID),
+		zap.String("todoist_name", user.FullName),
+	)
+	id := user.ID
 
-	chatID := ah.storage.GetChatID(state)
 	logger.Log.Debug("chat_ID",
-		zap.Int("chatID", chatID),
+		zap.Int64("chatID", chatID),
 	)
-	ah.r.AddTodoistUser(context.Background(), id, name)
-	ah.r.AddUserId(context.Background(), int64(chatID), id)
+	err = ah.link(r.Context(), chatID, user, token.AccessToken)
+	if errors.Is(err, errLinkedElsewhere) {
+		logger.Log.Info("Todoist user is linked to another chat",
+			zap.Int64("chat_id", chatID),
+			zap.String("todoist_id", id),
+		)
+		ah.botNotifier <- models.AuthNotification{
+			ChatID:          chatID,
+			Successful:      false,
+			LinkedElsewhere: true,
+		}
+		http.Error(w, "This Todoist account is already linked to another chat, use /logout there first", http.StatusConflict)
+		return
+	} else if err != nil {
+		logger.Log.Error("Error in linking todoist user",
+			zap.Int64("chat_id", chatID),
+			zap.String("todoist_id", id),
+			zap.Error(err),
+		)
+		ah.botNotifier <- models.AuthNotification{
+			ChatID:     chatID,
+			Successful: false,
+		}
+		http.Error(w, "Failed to link your Todoist account, request a new link with /auth in the bot", http.StatusInternalServerError)
+		return
+	}
 
 	ah.botNotifier <- models.AuthNotification{
-		ChatID:     int64(chatID),
+		ChatID:     chatID,
 		Successful: true,
 	}
 	http.Redirect(w, r, "/auth/auth_finish", http.StatusSeeOther)
 }
 
-func handleMain(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("main page!!!"))
-}
-
-func getUserID(token string) (string, string, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", SyncURL, nil)
-	if err != nil {
-		panic(err)
+// link stores the Todoist user with their token and links them to the chat. The chat
+// is linked last, so webhooks are only taken for users whose token is stored. An
+// account is linked to one chat only, as its events are sent to a single chat; linking
+// it to another chat returns errLinkedElsewhere.
+func (ah *AuthHandler) link(ctx context.Context, chatID int64, user models.SyncUser, token string) error {
+	linked, err := ah.r.GetChatIDByTodoist(ctx, user.ID)
+	if err == nil && linked != chatID {
+		return errLinkedElsewhere
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	// log.Println("performing request for getting id")
-	resp, err := client.Do(req)
-	if resp.StatusCode != http.StatusOK {
-		// log.Println(resp.StatusCode)
-		return "", "", nil
+	if err := ah.r.AddTodoistUser(ctx, user.ID, user.FullName, user.StartDay, user.TzInfo.Timezone); err != nil {
+		return err
 	}
-	if err != nil {
-		panic(err)
+	if err := ah.tokens.StoreToken(ctx, user.ID, token); err != nil {
+		return err
 	}
+	return ah.r.AddUserId(ctx, chatID, user.ID)
+}
 
-	// res, err := io.ReadAll(resp.Body)
-	// if err != nil {
-	// 	panic(err)
-	// }
-	// log.Printf("resp body: %s\n", string(res))
-	initReq := models.InitSyncReq{}
-	defer resp.Body.Close()
-	if err := json.NewDecoder(resp.Body).Decode(&initReq); err != nil {
-		// log.Println(err.Error())
-	}
-	// log.Println(initReq)
-	return initReq.User.ID, initReq.User.FullName, nil
+func handleMain(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("main page!!!"))
 }
 
 type Service struct {
@@ -203,18 +251,30 @@ type Service struct {
 }
 
 func NewService(authHandler *AuthHandler, webhookHandler *WebHookHandler) *Service {
-	return &Service{
-		srv: &http.Server{
-			Addr: ":8080",
-		},
+	s := &Service{
 		h: authHandler,
 		w: webhookHandler,
 	}
+	s.srv = &http.Server{
+		Addr:    ":8080",
+		Handler: s.routes(),
+	}
+	return s
+}
+
+func (s *Service) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", s.h.handleOAuth)
+	mux.HandleFunc("/auth/callback", s.h.handleCode)
+	mux.HandleFunc("/webhook", s.w.handleHTTP)
+	mux.HandleFunc("/main", handleMain)
+	mux.HandleFunc("/auth/auth_finish", s.h.handleAuthFinish)
+	return mux
 }
 
 // TODO :: hide auth finish page
-func handleAuthFinish(w http.ResponseWriter, r *http.Request) {
-	html := `
+func (ah *AuthHandler) handleAuthFinish(w http.ResponseWriter, r *http.Request) {
+	page := `
     <!DOCTYPE html>
     <html>
     <head>
@@ -230,21 +290,17 @@ func handleAuthFinish(w http.ResponseWriter, r *http.Request) {
     <body>
         <div class="success">Authentication Successful</div>
         <div class="message">Your Todoist account has been linked successfully.</div>
-        <a class="button" href="https://t.me/evdocim_test_bot">Return to Bot</a>
+        <a class="button" href="` + html.EscapeString(ah.botURL) + `">Return to Bot</a>
     </body>
     </html>
     `
 	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	w.Write([]byte(page))
 }
 
 func (s *Service) Start(wg *sync.WaitGroup, ctx context.Context) {
-
-	http.HandleFunc("/auth", s.h.handleOAuth)
-	http.HandleFunc("/auth/callback", s.h.handleCode)
-	http.HandleFunc("/webhook", s.w.handleHTTP)
-	http.HandleFunc("/main", handleMain)
-	http.HandleFunc("/auth/auth_finish", handleAuthFinish)
+	s.h.Start(wg, ctx)
+	s.w.Start(wg, ctx)
 
 	wg.Add(1)
 	go func() {
@@ -266,3 +322,43 @@ func (s *Service) Start(wg *sync.WaitGroup, ctx context.Context) {
 		}
 	}()
 }
+
+// Logout unlinks the Todoist account from the chat, so webhooks of that account are no
+// longer sent to it. The token is revoked unless other chats still use the account. It
+// returns repository.ErrNotFound if the chat has no linked account.
+func (ah *AuthHandler) Logout(ctx context.Context, chatID int64) error {
+	todoistID, err := ah.r.GetTodoistIDByChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	shared, err := ah.r.OtherChatsLinked(ctx, chatID, todoistID)
+	if err != nil {
+		return err
+	}
+	if shared {
+		return ah.r.UnlinkChat(ctx, chatID, todoistID)
+	}
+	token, err := ah.tokens.GetToken(ctx, todoistID)
+	if err == nil {
+		if err := ah.revokeToken(ctx, token); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return ah.r.UnlinkChat(ctx, chatID, todoistID)
+}
+
+// revokeToken invalidates the token at Todoist. Client errors mean the token is already
+// unusable, so only network and server failures are reported.
+func (ah *AuthHandler) revokeToken(ctx context.Context, token string) error {
+	err := ah.client.RevokeToken(ctx, token)
+	var apiErr *todoist.APIError
+	if errors.As(err, &apiErr) && !apiErr.Retryable() {
+		logger.Log.Warn("Todoist refused to revoke token",
+			zap.Int("status", apiErr.StatusCode),
+		)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"testing"
+
+	"example.com/bot/internal/service/todoist/todoisttest"
+	"example.com/bot/pkg/todoist"
+)
+
+const testClientID = "test-client-id"
+
+// newTestClient starts a fake Todoist, closed when the test is done, and returns a
+// client that talks to it.
+func newTestClient(t *testing.T) (*todoist.Client, *todoisttest.Server) {
+	t.Helper()
+	fake := todoisttest.New(testClientID, testClientSecret)
+	t.Cleanup(fake.Close)
+	client := todoist.New(todoist.Config{
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		TokenURL:     fake.TokenURL(),
+		APIURL:       fake.APIURL(),
+	})
+	return client, fake
+}
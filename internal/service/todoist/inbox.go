@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"go.uber.org/zap"
+)
+
+const (
+	inboxPollInterval = 5 * time.Second
+	inboxBatchSize    = 16
+	inboxLease        = 5 * time.Minute
+	inboxMaxAttempts  = 10
+	inboxRetryBase    = 10 * time.Second
+	inboxRetryMax     = time.Hour
+)
+
+// Start runs the inbox worker, which processes stored webhooks until ctx is done.
+// It wakes up on every accepted webhook and polls for due retries in between.
+func (wh *WebHookHandler) Start(wg *sync.WaitGroup, ctx context.Context) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(inboxPollInterval)
+		defer ticker.Stop()
+		for {
+			wh.drainInbox(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-wh.wake:
+			}
+		}
+	}()
+}
+
+func (wh *WebHookHandler) drainInbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		items, err := wh.r.ClaimWebHooks(ctx, inboxBatchSize, inboxLease)
+		if err != nil {
+			return
+		}
+		for _, item := range items {
+			wh.processInboxItem(ctx, item)
+		}
+		if len(items) < inboxBatchSize {
+			return
+		}
+	}
+}
+
+func (wh *WebHookHandler) processInboxItem(ctx context.Context, item models.InboxItem) {
+	log := logger.Log.With(
+		zap.Int64("inbox_id", item.ID),
+		zap.Int("attempt", item.Attempts),
+	)
+	req := models.WebHookRequest{}
+	err := json.Unmarshal(item.Payload, &req)
+	if err == nil {
+		log = log.With(zap.String("event_key", eventKey(&req)))
+		err = wh.processWebHook(ctx, &req)
+	}
+	if err == nil {
+		if err := wh.r.CompleteWebHook(ctx, item.ID); err != nil {
+			// the row is processed again once its lease expires
+			log.Error("Error in completing webhook",
+				zap.Error(err),
+			)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		// shutting down, the row is picked up again once its lease expires
+		return
+	}
+	if item.Attempts >= inboxMaxAttempts {
+		log.Error("Giving up on webhook",
+			zap.Error(err),
+		)
+		if err := wh.r.BuryWebHook(ctx, item.ID, err.Error()); err != nil {
+			log.Error("Error in burying webhook",
+				zap.Error(err),
+			)
+		}
+		return
+	}
+	delay := retryDelay(item.Attempts)
+	log.Warn("Webhook processing failed, will retry",
+		zap.Duration("delay", delay),
+		zap.Error(err),
+	)
+	if err := wh.r.RetryWebHook(ctx, item.ID, time.Now().Add(delay), err.Error()); err != nil {
+		log.Error("Error in scheduling webhook retry",
+			zap.Error(err),
+		)
+	}
+}
+
+// retryDelay doubles the wait with every attempt, up to inboxRetryMax.
+func retryDelay(attempt int) time.Duration {
+	delay := inboxRetryBase
+	for i := 1; i < attempt && delay < inboxRetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, inboxRetryMax)
+}
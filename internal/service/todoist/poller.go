@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/todoist"
+	"go.uber.org/zap"
+)
+
+const (
+	pollInterval = time.Minute
+	// pollOverlap widens every poll window to the past, so completions stamped slightly
+	// out of order are not missed. The event key drops the ones seen twice.
+	pollOverlap = 5 * time.Minute
+)
+
+// Poller receives completions by asking Todoist for the completed tasks of every user,
+// for deployments Todoist cannot send webhooks to. The completions go through the inbox
+// as if they came from webhooks.
+type Poller struct {
+	r      SyncRepository
+	tokens TokenStorage
+	client *todoist.Client
+	events EventQueue
+
+	// polled is the end of the last poll window of each user
+	polled map[string]time.Time
+	now    func() time.Time
+}
+
+func NewPoller(r SyncRepository, tokens TokenStorage, client *todoist.Client, events EventQueue) *Poller {
+	return &Poller{
+		r:      r,
+		tokens: tokens,
+		client: client,
+		events: events,
+		polled: make(map[string]time.Time),
+		now:    time.Now,
+	}
+}
+
+func (p *Poller) Start(wg *sync.WaitGroup, ctx context.Context) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			p.pollAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (p *Poller) pollAll(ctx context.Context) {
+	ids, err := p.r.GetTodoistUserIDs(ctx)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := p.pollUser(ctx, id); err != nil {
+			logger.Log.Warn("Error in polling todoist user",
+				zap.String("todoist_id", id),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// pollUser queues the completions of the user since the last poll. Users seen for the
+// first time are polled from one interval back; older completions are left to the sync
+// worker. The window is not moved on unless every completion was queued.
+func (p *Poller) pollUser(ctx context.Context, todoistID string) error {
+	token, err := p.tokens.GetToken(ctx, todoistID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// logged out
+		delete(p.polled, todoistID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	until := p.now()
+	since, ok := p.polled[todoistID]
+	if !ok {
+		since = until.Add(-pollInterval)
+	}
+	tasks, err := p.client.GetCompletedTasks(ctx, token, since.Add(-pollOverlap), until)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if task.CompletedAt == nil {
+			continue
+		}
+		if _, err := enqueueCompletion(ctx, p.events, todoistID, task); err != nil {
+			return err
+		}
+	}
+	p.polled[todoistID] = until
+	return nil
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"example.com/bot/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoller_pollUser(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.AddToken("token")
+
+	now := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	old := models.Task{ID: "old", Content: "Before linking", Labels: []string{"log0030"}, CompletedAt: at(-2 * time.Hour)}
+	recent := models.Task{ID: "recent", Content: "Recent", Labels: []string{"log0030"}, CompletedAt: at(-2 * time.Minute)}
+	next := models.Task{ID: "next", Content: "Next", Labels: []string{"log0100"}, CompletedAt: at(30 * time.Second)}
+	fake.SetCompleted([]models.Task{old, recent, next})
+
+	updates := make(chan models.WebHookParsed, 1)
+	events := newFakeRepository()
+	wh := NewWebHookHandler(updates, testClientSecret, events, nil, nil)
+	p := NewPoller(&fakeSyncRepository{}, &fakeTokens{tokens: map[string]string{"user123": "token"}}, client, wh)
+	p.now = func() time.Time { return now }
+
+	assert.NoError(t, p.pollUser(context.Background(), "user123"))
+	assert.Equal(t, []string{"item:completed:recent:2025-04-10T11:58:00Z"}, enqueuedKeys(t, events))
+
+	// the overlap fetches recent again, which the event key drops
+	now = now.Add(pollInterval)
+	assert.NoError(t, p.pollUser(context.Background(), "user123"))
+	assert.Equal(t, []string{
+		"item:completed:recent:2025-04-10T11:58:00Z",
+		"item:completed:next:2025-04-10T12:00:30Z",
+	}, enqueuedKeys(t, events))
+
+	// polled completions are processed like webhooks
+	wh.processInboxItem(context.Background(), models.InboxItem{ID: 1, Payload: events.enqueued[1], Attempts: 1})
+	select {
+	case wp := <-updates:
+		assert.Equal(t, models.WebHookParsed{
+			UserID:      "user123",
+			ChatID:      testChatID,
+			TaskID:      "next",
+			Task:        "Next",
+			TimeSpent:   60,
+			EventKey:    "item:completed:next:2025-04-10T12:00:30Z",
+			Labels:      []string{"log0100"},
+			CompletedAt: next.CompletedAt,
+		}, wp)
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for tracked task notification")
+	}
+}
+
+func enqueuedKeys(t *testing.T, f *fakeRepository) []string {
+	keys := make([]string, 0, len(f.enqueued))
+	for _, payload := range f.enqueued {
+		req := models.WebHookRequest{}
+		assert.NoError(t, json.Unmarshal(payload, &req))
+		keys = append(keys, eventKey(&req))
+	}
+	return keys
+}
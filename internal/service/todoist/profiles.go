@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/pkg/todoist"
+	"go.uber.org/zap"
+)
+
+const profileRefreshInterval = 12 * time.Hour
+
+// ProfileRepository is the storage used by the profile refresher.
+type ProfileRepository interface {
+	GetTodoistUserIDs(ctx context.Context) ([]string, error)
+	AddTodoistUser(ctx context.Context, todoistID string, userName string, startDay int, timezone string) error
+}
+
+// ProfileRefresher keeps the stored Todoist profiles, such as the timezone and the
+// first day of the week, in line with the users' Todoist settings.
+type ProfileRefresher struct {
+	r      ProfileRepository
+	tokens TokenStorage
+	client *todoist.Client
+}
+
+func NewProfileRefresher(r ProfileRepository, tokens TokenStorage, client *todoist.Client) *ProfileRefresher {
+	return &ProfileRefresher{
+		r:      r,
+		tokens: tokens,
+		client: client,
+	}
+}
+
+func (pr *ProfileRefresher) Start(wg *sync.WaitGroup, ctx context.Context) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(profileRefreshInterval)
+		defer ticker.Stop()
+		for {
+			pr.refresh(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (pr *ProfileRefresher) refresh(ctx context.Context) {
+	ids, err := pr.r.GetTodoistUserIDs(ctx)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		token, err := pr.tokens.GetToken(ctx, id)
+		if err != nil {
+			continue
+		}
+		user, err := pr.client.GetUser(ctx, token)
+		if err != nil || user.ID != id {
+			logger.Log.Warn("Error in refreshing todoist profile",
+				zap.String("todoist_id", id),
+				zap.Error(err),
+			)
+			continue
+		}
+		if err := pr.r.AddTodoistUser(ctx, user.ID, user.FullName, user.StartDay, user.TzInfo.Timezone); err != nil {
+			logger.Log.Warn("Error in storing todoist profile",
+				zap.String("todoist_id", id),
+				zap.Error(err),
+			)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"example.com/bot/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileRefresher_refresh(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.AddToken("token")
+	user := models.SyncUser{ID: "user123", FullName: "Test User", StartDay: 7}
+	user.TzInfo.Timezone = "America/New_York"
+	fake.SetSync(models.InitSyncReq{User: user})
+
+	repo := &fakeProfileRepository{
+		ids:   []string{"user123", "user456", "user789"},
+		users: map[string]models.SyncUser{"user123": {ID: "user123", FullName: "Test User", StartDay: 1}},
+	}
+	// user456 has no token, and the token of user789 belongs to another account
+	tokens := &fakeTokens{tokens: map[string]string{"user123": "token", "user789": "token"}}
+	NewProfileRefresher(repo, tokens, client).refresh(context.Background())
+
+	if assert.Len(t, repo.users, 1) {
+		assert.Equal(t, 7, repo.users["user123"].StartDay)
+		assert.Equal(t, "America/New_York", repo.users["user123"].TzInfo.Timezone)
+	}
+}
+
+type fakeProfileRepository struct {
+	ids   []string
+	users map[string]models.SyncUser
+}
+
+func (f *fakeProfileRepository) GetTodoistUserIDs(ctx context.Context) ([]string, error) {
+	return f.ids, nil
+}
+
+func (f *fakeProfileRepository) AddTodoistUser(ctx context.Context, todoistID string, userName string, startDay int, timezone string) error {
+	user := models.SyncUser{ID: todoistID, FullName: userName, StartDay: startDay}
+	user.TzInfo.Timezone = timezone
+	f.users[todoistID] = user
+	return nil
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/todoist"
+)
+
+var errNoToken = errors.New("no todoist token for chat")
+
+// ProjectRepository keeps the project names of the Todoist accounts linked to chats.
+type ProjectRepository interface {
+	GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error)
+	StoreProjects(ctx context.Context, todoistID string, projects []models.Project) error
+}
+
+// ProjectResolver keeps the names of the users' Todoist projects, so stats can show
+// them instead of project IDs.
+type ProjectResolver struct {
+	r      ProjectRepository
+	tokens TokenStorage
+	client *todoist.Client
+}
+
+func NewProjectResolver(r ProjectRepository, tokens TokenStorage, client *todoist.Client) *ProjectResolver {
+	return &ProjectResolver{
+		r:      r,
+		tokens: tokens,
+		client: client,
+	}
+}
+
+// SyncProjects fetches the projects of the Todoist account linked to the chat and
+// stores their names.
+func (pr *ProjectResolver) SyncProjects(ctx context.Context, chatID int64) error {
+	todoistID, err := pr.r.GetTodoistIDByChat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	token, err := pr.tokens.GetToken(ctx, todoistID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return errNoToken
+	} else if err != nil {
+		return err
+	}
+	projects, err := pr.client.GetProjects(ctx, token)
+	if err != nil {
+		return err
+	}
+	return pr.r.StoreProjects(ctx, todoistID, projects)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectResolver_SyncProjects(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.AddToken("token")
+	fake.AddProject(models.Project{ID: "p1", Name: "Work"})
+	fake.AddProject(models.Project{ID: "p2", Name: "Home"})
+
+	repo := &fakeProjectRepository{
+		links:    map[int64]string{testChatID: "user123", testChatID + 1: "user456"},
+		projects: make(map[string][]models.Project),
+	}
+	pr := NewProjectResolver(repo, &fakeTokens{tokens: map[string]string{"user123": "token"}}, client)
+
+	assert.NoError(t, pr.SyncProjects(context.Background(), testChatID))
+	assert.ElementsMatch(t, []models.Project{{ID: "p1", Name: "Work"}, {ID: "p2", Name: "Home"}}, repo.projects["user123"])
+
+	assert.ErrorIs(t, pr.SyncProjects(context.Background(), testChatID+1), errNoToken)
+	assert.ErrorIs(t, pr.SyncProjects(context.Background(), testChatID+2), repository.ErrNotFound)
+}
+
+type fakeProjectRepository struct {
+	links    map[int64]string
+	projects map[string][]models.Project
+}
+
+func (f *fakeProjectRepository) GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error) {
+	todoistID, ok := f.links[chatID]
+	if !ok {
+		return "", repository.ErrNotFound
+	}
+	return todoistID, nil
+}
+
+func (f *fakeProjectRepository) StoreProjects(ctx context.Context, todoistID string, projects []models.Project) error {
+	f.projects[todoistID] = projects
+	return nil
+}
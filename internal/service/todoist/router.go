@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"go.uber.org/zap"
+)
+
+// EventHandler handles Todoist webhook events. A returned error makes the inbox retry
+// the event later.
+type EventHandler interface {
+	HandleEvent(ctx context.Context, req *models.WebHookRequest) error
+}
+
+// EventHandlerFunc adapts a function to EventHandler.
+type EventHandlerFunc func(ctx context.Context, req *models.WebHookRequest) error
+
+func (f EventHandlerFunc) HandleEvent(ctx context.Context, req *models.WebHookRequest) error {
+	return f(ctx, req)
+}
+
+// EventRouter dispatches webhook events to the handler registered for their event_name.
+type EventRouter struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandler
+	unknown  map[string]uint64
+}
+
+func NewEventRouter() *EventRouter {
+	return &EventRouter{
+		handlers: make(map[string]EventHandler),
+		unknown:  make(map[string]uint64),
+	}
+}
+
+// Register sets the handler for eventName, which is either a full name such as
+// "item:completed" or a whole family such as "item:*". Full names take precedence
+// over families.
+func (er *EventRouter) Register(eventName string, h EventHandler) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+	er.handlers[eventName] = h
+}
+
+// Dispatch passes req to its handler. Events without a handler are logged, counted
+// and considered done.
+func (er *EventRouter) Dispatch(ctx context.Context, req *models.WebHookRequest) error {
+	h := er.lookup(req.EventName)
+	if h == nil {
+		er.mu.Lock()
+		er.unknown[req.EventName]++
+		count := er.unknown[req.EventName]
+		er.mu.Unlock()
+		logger.Log.Warn("Unhandled webhook event",
+			zap.String("event_name", req.EventName),
+			zap.String("user_id", req.UserID),
+			zap.Uint64("seen", count),
+		)
+		return nil
+	}
+	return h.HandleEvent(ctx, req)
+}
+
+func (er *EventRouter) lookup(eventName string) EventHandler {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	if h, ok := er.handlers[eventName]; ok {
+		return h
+	}
+	if family, _, ok := strings.Cut(eventName, ":"); ok {
+		return er.handlers[family+":*"]
+	}
+	return nil
+}
+
+// UnknownEvents returns how many events without a handler were seen, by event name.
+func (er *EventRouter) UnknownEvents() map[string]uint64 {
+	er.mu.RLock()
+	defer er.mu.RUnlock()
+	res := make(map[string]uint64, len(er.unknown))
+	for name, count := range er.unknown {
+		res[name] = count
+	}
+	return res
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"example.com/bot/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventRouter_Dispatch(t *testing.T) {
+	var handled []string
+	record := func(name string) EventHandler {
+		return EventHandlerFunc(func(ctx context.Context, req *models.WebHookRequest) error {
+			handled = append(handled, name+" "+req.EventName)
+			return nil
+		})
+	}
+	failing := errors.New("failed")
+
+	router := NewEventRouter()
+	router.Register("item:completed", record("completed"))
+	router.Register("item:*", record("item"))
+	router.Register("note:added", EventHandlerFunc(func(ctx context.Context, req *models.WebHookRequest) error {
+		return failing
+	}))
+
+	dispatch := func(eventName string) error {
+		return router.Dispatch(context.Background(), &models.WebHookRequest{EventName: eventName})
+	}
+
+	assert.NoError(t, dispatch("item:completed"))
+	assert.NoError(t, dispatch("item:deleted"))
+	assert.ErrorIs(t, dispatch("note:added"), failing)
+	assert.NoError(t, dispatch("project:added"))
+	assert.NoError(t, dispatch("project:added"))
+	assert.NoError(t, dispatch("wtf"))
+
+	assert.Equal(t, []string{"completed item:completed", "item item:deleted"}, handled)
+	assert.Equal(t, map[string]uint64{"project:added": 2, "wtf": 1}, router.UnknownEvents())
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// stateTTL bounds the time between /auth and the OAuth callback. The state cookie
+	// lives as long.
+	stateTTL           = 5 * time.Minute
+	statePurgeInterval = 30 * time.Minute
+)
+
+// Start periodically removes the OAuth states of flows that were never finished.
+func (ah *AuthHandler) Start(wg *sync.WaitGroup, ctx context.Context) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(statePurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := ah.r.PurgeOAuthStates(ctx)
+				if err != nil {
+					continue
+				}
+				logger.Log.Debug("Purged expired oauth states",
+					zap.Int64("count", purged),
+				)
+			}
+		}
+	}()
+}
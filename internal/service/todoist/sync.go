@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/todoist"
+	"go.uber.org/zap"
+)
+
+const syncInterval = 15 * time.Minute
+
+// SyncRepository is the storage used by the sync worker.
+type SyncRepository interface {
+	GetTodoistUserIDs(ctx context.Context) ([]string, error)
+	GetSyncToken(ctx context.Context, todoistID string) (string, error)
+	SetSyncToken(ctx context.Context, todoistID, syncToken string) error
+}
+
+// EventQueue accepts events for processing like webhooks.
+type EventQueue interface {
+	Enqueue(ctx context.Context, req *models.WebHookRequest) (bool, error)
+}
+
+// SyncWorker recovers completions whose webhooks were never received. It follows the
+// items of every user with incremental syncs and queues the completions it finds; the
+// ones already seen through webhooks are dropped by their event key.
+type SyncWorker struct {
+	r      SyncRepository
+	tokens TokenStorage
+	client *todoist.Client
+	events EventQueue
+}
+
+func NewSyncWorker(r SyncRepository, tokens TokenStorage, client *todoist.Client, events EventQueue) *SyncWorker {
+	return &SyncWorker{
+		r:      r,
+		tokens: tokens,
+		client: client,
+		events: events,
+	}
+}
+
+func (sw *SyncWorker) Start(wg *sync.WaitGroup, ctx context.Context) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		for {
+			sw.syncAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (sw *SyncWorker) syncAll(ctx context.Context) {
+	ids, err := sw.r.GetTodoistUserIDs(ctx)
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := sw.syncUser(ctx, id); err != nil {
+			logger.Log.Warn("Error in syncing todoist user",
+				zap.String("todoist_id", id),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// syncUser queues the completions of the user since the last sync. The first sync only
+// records where to start from, so completions made before the account was linked are
+// not counted. The sync token is kept unless every completion was queued, so a failed
+// sync is repeated in full.
+func (sw *SyncWorker) syncUser(ctx context.Context, todoistID string) error {
+	token, err := sw.tokens.GetToken(ctx, todoistID)
+	if errors.Is(err, repository.ErrNotFound) {
+		// logged out
+		return nil
+	} else if err != nil {
+		return err
+	}
+	syncToken, err := sw.r.GetSyncToken(ctx, todoistID)
+	if err != nil {
+		return err
+	}
+	initial := syncToken == ""
+	if initial {
+		syncToken = "*"
+	}
+	resp, err := sw.client.Sync(ctx, token, syncToken, "items")
+	if err != nil {
+		return err
+	}
+	if !initial {
+		for _, item := range resp.Items {
+			if err := sw.enqueueCompleted(ctx, todoistID, item); err != nil {
+				return err
+			}
+		}
+	}
+	return sw.r.SetSyncToken(ctx, todoistID, resp.SyncToken)
+}
+
+func (sw *SyncWorker) enqueueCompleted(ctx context.Context, todoistID string, item models.Task) error {
+	if !item.Checked || item.IsDeleted || item.CompletedAt == nil {
+		return nil
+	}
+	enqueued, err := enqueueCompletion(ctx, sw.events, todoistID, item)
+	if err != nil {
+		return err
+	}
+	if enqueued {
+		logger.Log.Warn("Recovered completion missed by webhooks",
+			zap.String("todoist_id", todoistID),
+			zap.String("task_id", item.ID),
+		)
+	}
+	return nil
+}
+
+// enqueueCompletion queues the completion of task by the Todoist user as an
+// item:completed event, the way the webhook would deliver it.
+func enqueueCompletion(ctx context.Context, events EventQueue, todoistID string, task models.Task) (bool, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return false, err
+	}
+	return events.Enqueue(ctx, &models.WebHookRequest{
+		EventName: itemCompletedEvent,
+		UserID:    todoistID,
+		EventData: data,
+	})
+}
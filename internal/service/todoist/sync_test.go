@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"example.com/bot/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncWorker_syncUser(t *testing.T) {
+	client, fake := newTestClient(t)
+	fake.AddToken("token")
+
+	completedAt := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	done := models.Task{ID: "task1", Content: "Done", Labels: []string{"log0030"}, Checked: true, CompletedAt: &completedAt}
+	open := models.Task{ID: "task2", Content: "Open"}
+
+	repo := &fakeSyncRepository{syncTokens: make(map[string]string)}
+	updates := make(chan models.WebHookParsed, 1)
+	events := newFakeRepository()
+	wh := NewWebHookHandler(updates, testClientSecret, events, nil, nil)
+	sw := NewSyncWorker(repo, &fakeTokens{tokens: map[string]string{"user123": "token"}}, client, wh)
+
+	// the first sync only records the starting point
+	fake.SetSync(models.InitSyncReq{FullSync: true, SyncToken: "s1", Items: []models.Task{done, open}})
+	assert.NoError(t, sw.syncUser(context.Background(), "user123"))
+	assert.Empty(t, events.enqueued)
+	assert.Equal(t, "s1", repo.syncTokens["user123"])
+
+	fake.SetSync(models.InitSyncReq{SyncToken: "s2", Items: []models.Task{done, open}})
+	assert.NoError(t, sw.syncUser(context.Background(), "user123"))
+	assert.Equal(t, "s2", repo.syncTokens["user123"])
+	if assert.Len(t, events.enqueued, 1) {
+		req := models.WebHookRequest{}
+		assert.NoError(t, json.Unmarshal(events.enqueued[0], &req))
+		assert.Equal(t, itemCompletedEvent, req.EventName)
+		assert.Equal(t, "user123", req.UserID)
+		assert.Equal(t, "item:completed:task1:2025-04-10T12:00:00Z", eventKey(&req))
+	}
+
+	// a completion already delivered by webhook is not queued again
+	fake.SetSync(models.InitSyncReq{SyncToken: "s3", Items: []models.Task{done}})
+	assert.NoError(t, sw.syncUser(context.Background(), "user123"))
+	assert.Len(t, events.enqueued, 1)
+	assert.Equal(t, []string{"*", "s1", "s2"}, fake.SyncTokens())
+
+	// logged out users are skipped
+	assert.NoError(t, sw.syncUser(context.Background(), "user456"))
+	assert.Len(t, fake.SyncTokens(), 3)
+}
+
+type fakeSyncRepository struct {
+	syncTokens map[string]string
+}
+
+func (f *fakeSyncRepository) GetTodoistUserIDs(ctx context.Context) ([]string, error) {
+	return []string{"user123", "user456"}, nil
+}
+
+func (f *fakeSyncRepository) GetSyncToken(ctx context.Context, todoistID string) (string, error) {
+	return f.syncTokens[todoistID], nil
+}
+
+func (f *fakeSyncRepository) SetSyncToken(ctx context.Context, todoistID, syncToken string) error {
+	f.syncTokens[todoistID] = syncToken
+	return nil
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/todoist"
+	"go.uber.org/zap"
+)
+
+// AccountRepository finds the Todoist account linked to a chat.
+type AccountRepository interface {
+	GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error)
+}
+
+// TaskManager works with the Todoist tasks of the account linked to a chat.
+type TaskManager struct {
+	r      AccountRepository
+	tokens TokenStorage
+	client *todoist.Client
+	events EventQueue
+}
+
+func NewTaskManager(r AccountRepository, tokens TokenStorage, client *todoist.Client, events EventQueue) *TaskManager {
+	return &TaskManager{
+		r:      r,
+		tokens: tokens,
+		client: client,
+		events: events,
+	}
+}
+
+// QuickAdd creates a task from text with the Todoist quick add syntax and returns it
+// with its project. It returns repository.ErrNotFound if the chat has no linked account.
+func (tm *TaskManager) QuickAdd(ctx context.Context, chatID int64, text string) (models.Task, models.Project, error) {
+	_, token, err := tm.account(ctx, chatID)
+	if err != nil {
+		return models.Task{}, models.Project{}, err
+	}
+	task, err := tm.client.QuickAdd(ctx, token, text)
+	if err != nil {
+		return models.Task{}, models.Project{}, err
+	}
+	project, err := tm.client.GetProject(ctx, token, task.ProjectID)
+	if err != nil {
+		// the task is created, only its project name is missing
+		project = models.Project{ID: task.ProjectID}
+	}
+	return task, project, nil
+}
+
+// Today returns the active tasks of the chat's account that are due today.
+func (tm *TaskManager) Today(ctx context.Context, chatID int64) ([]models.Task, error) {
+	_, token, err := tm.account(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return tm.client.FilterTasks(ctx, token, "today")
+}
+
+// Task returns the task of the chat's account.
+func (tm *TaskManager) Task(ctx context.Context, chatID int64, taskID string) (models.Task, error) {
+	_, token, err := tm.account(ctx, chatID)
+	if err != nil {
+		return models.Task{}, err
+	}
+	return tm.client.GetTask(ctx, token, taskID)
+}
+
+// Complete completes the task in Todoist and queues the completion for tracking like a
+// webhook. With track the track label is added to the task before it is closed, so the
+// chat is asked for the time whichever of the two completions is processed.
+//
+// The completion is queued with the completion time Todoist stored, so it has the same
+// event key as the webhook Todoist sends and is only counted once. If that time cannot
+// be read back, the completion is left to the webhook.
+func (tm *TaskManager) Complete(ctx context.Context, chatID int64, taskID string, track bool) (models.Task, error) {
+	todoistID, token, err := tm.account(ctx, chatID)
+	if err != nil {
+		return models.Task{}, err
+	}
+	task, err := tm.client.GetTask(ctx, token, taskID)
+	if err != nil {
+		return models.Task{}, err
+	}
+	if track && !slices.Contains(task.Labels, trackLabel) {
+		// the webhook may be queued before the completion below and has to ask as well
+		labels := append(slices.Clone(task.Labels), trackLabel)
+		if err := tm.client.UpdateTask(ctx, token, taskID, todoist.TaskUpdate{Labels: labels}); err != nil {
+			return models.Task{}, err
+		}
+		task.Labels = labels
+	}
+	if err := tm.client.CloseTask(ctx, token, taskID); err != nil {
+		return models.Task{}, err
+	}
+	closed, err := tm.client.GetTask(ctx, token, taskID)
+	if err != nil || closed.CompletedAt == nil {
+		logger.Log.Warn("Completion time unknown, leaving task to webhook",
+			zap.String("task_id", taskID),
+			zap.Error(err),
+		)
+		return task, nil
+	}
+	if track && !slices.Contains(closed.Labels, trackLabel) {
+		closed.Labels = append(slices.Clone(closed.Labels), trackLabel)
+	}
+	enqueued, err := enqueueCompletion(ctx, tm.events, todoistID, closed)
+	if err != nil {
+		return closed, err
+	}
+	if !enqueued {
+		logger.Log.Debug("Completion already queued by webhook",
+			zap.String("task_id", taskID),
+		)
+	}
+	return closed, nil
+}
+
+// account returns the Todoist user linked to the chat and their token.
+func (tm *TaskManager) account(ctx context.Context, chatID int64) (string, string, error) {
+	todoistID, err := tm.r.GetTodoistIDByChat(ctx, chatID)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := tm.tokens.GetToken(ctx, todoistID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", "", repository.ErrNotFound
+	} else if err != nil {
+		return "", "", err
+	}
+	return todoistID, token, nil
+}
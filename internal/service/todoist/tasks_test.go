@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/internal/service/todoist/todoisttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTaskManager(t *testing.T) (*TaskManager, *todoisttest.Server, *fakeRepository) {
+	client, fake := newTestClient(t)
+	fake.AddToken("token")
+	repo := newFlowRepository()
+	repo.links[testChatID] = "user123"
+	wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+	return NewTaskManager(repo, &fakeTokens{tokens: map[string]string{"user123": "token"}}, client, wh), fake, repo.fakeRepository
+}
+
+func TestTaskManager_QuickAdd(t *testing.T) {
+	tm, fake, _ := newTestTaskManager(t)
+	fake.AddProject(models.Project{ID: "p1", Name: "Work"})
+
+	task, project, err := tm.QuickAdd(context.Background(), testChatID, "Write report #Work")
+	assert.NoError(t, err)
+	assert.Equal(t, "Write report", task.Content)
+	assert.Equal(t, models.Project{ID: "p1", Name: "Work"}, project)
+	assert.Len(t, fake.Added(), 1)
+
+	// an unknown project name does not fail the already created task
+	task, project, err = tm.QuickAdd(context.Background(), testChatID, "Buy milk")
+	assert.NoError(t, err)
+	assert.Equal(t, "Buy milk", task.Content)
+	assert.Equal(t, models.Project{ID: "inbox"}, project)
+
+	_, _, err = tm.QuickAdd(context.Background(), 7, "Buy milk")
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestTaskManager_Complete(t *testing.T) {
+	tm, fake, events := newTestTaskManager(t)
+	due := &models.Due{Date: "2025-04-10", String: "today"}
+	fake.AddTask(models.Task{ID: "task1", Content: "Plain", Due: due})
+	fake.AddTask(models.Task{ID: "task2", Content: "Timed", Due: due, Labels: []string{"calls"}})
+	fake.AddTask(models.Task{ID: "task3", Content: "Someday"})
+
+	tasks, err := tm.Today(context.Background(), testChatID)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+
+	task, err := tm.Complete(context.Background(), testChatID, "task1", false)
+	assert.NoError(t, err)
+	assert.True(t, fake.Task("task1").Checked)
+	assert.Equal(t, fake.Task("task1").CompletedAt, task.CompletedAt)
+
+	_, err = tm.Complete(context.Background(), testChatID, "task2", true)
+	assert.NoError(t, err)
+	if !assert.Len(t, events.enqueued, 2) {
+		return
+	}
+	req := models.WebHookRequest{}
+	assert.NoError(t, json.Unmarshal(events.enqueued[1], &req))
+	completed := models.Task{}
+	assert.NoError(t, json.Unmarshal(req.EventData, &completed))
+	assert.Equal(t, []string{"calls", "track"}, completed.Labels)
+	assert.Equal(t, []string{"calls", "track"}, fake.Task("task2").Labels)
+
+	// the webhook Todoist sends for the same completion is dropped
+	resp, err := fake.SendWebhook(newWebhookServer(t, tm.events.(*WebHookHandler)), createWebhookRequestRaw("item:completed", "user123", fake.Task("task2")))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Len(t, events.enqueued, 2)
+}
+
+func TestTaskManager_Complete_webhookFirst(t *testing.T) {
+	tm, fake, events := newTestTaskManager(t)
+	fake.AddTask(models.Task{ID: "task1", Content: "Timed", Labels: []string{"calls"}})
+	srv := newWebhookServer(t, tm.events.(*WebHookHandler))
+	fake.OnClose(func(task models.Task) {
+		resp, err := fake.SendWebhook(srv, createWebhookRequestRaw("item:completed", "user123", task))
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	})
+
+	_, err := tm.Complete(context.Background(), testChatID, "task1", true)
+	assert.NoError(t, err)
+	// the webhook took the event key, and it carries the track label
+	if !assert.Len(t, events.enqueued, 1) {
+		return
+	}
+	req := models.WebHookRequest{}
+	assert.NoError(t, json.Unmarshal(events.enqueued[0], &req))
+	completed := models.Task{}
+	assert.NoError(t, json.Unmarshal(req.EventData, &completed))
+	assert.Equal(t, []string{"calls", "track"}, completed.Labels)
+}
+
+func newWebhookServer(t *testing.T, wh *WebHookHandler) string {
+	srv := httptest.NewServer(http.HandlerFunc(wh.handleHTTP))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"go.uber.org/zap"
+)
+
+// TimerRepository keeps the running timers and the time they measured.
+type TimerRepository interface {
+	StartTimer(ctx context.Context, chatID int64, timer models.Timer) (bool, error)
+	GetTimer(ctx context.Context, chatID int64) (models.Timer, error)
+	DeleteTimer(ctx context.Context, chatID int64, startedAt time.Time) error
+	GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error)
+	StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) (bool, error)
+}
+
+// Timers measures the time spent on a task while it is worked on. A chat has at most
+// one running timer, which is stored once stopped.
+type Timers struct {
+	r      TimerRepository
+	writer TrackedWriter
+	now    func() time.Time
+}
+
+// NewTimers returns the timers of all chats. writer, if not nil, is told about every
+// stopped timer whose time was stored.
+func NewTimers(r TimerRepository, writer TrackedWriter) *Timers {
+	return &Timers{
+		r:      r,
+		writer: writer,
+		now:    time.Now,
+	}
+}
+
+// Start starts a timer for the task and returns it. If a timer is already running,
+// started is false and the running timer is returned instead.
+func (t *Timers) Start(ctx context.Context, chatID int64, timer models.Timer) (running models.Timer, started bool, err error) {
+	// the database keeps microseconds, the start time must match when the timer is deleted
+	timer.StartedAt = t.now().Truncate(time.Microsecond)
+	started, err = t.r.StartTimer(ctx, chatID, timer)
+	if err != nil {
+		return models.Timer{}, false, err
+	}
+	if !started {
+		running, err = t.r.GetTimer(ctx, chatID)
+		return running, false, err
+	}
+	return timer, true, nil
+}
+
+// Status returns the running timer of the chat. It returns repository.ErrNotFound if
+// no timer is running.
+func (t *Timers) Status(ctx context.Context, chatID int64) (models.Timer, error) {
+	return t.r.GetTimer(ctx, chatID)
+}
+
+// Elapsed returns the minutes measured by the timer so far, at least one.
+func (t *Timers) Elapsed(timer models.Timer) uint32 {
+	return elapsed(timer, t.now())
+}
+
+// Stop stops the running timer of the chat and stores its time. It returns
+// repository.ErrNotFound if no timer is running.
+func (t *Timers) Stop(ctx context.Context, chatID int64) (models.WebHookParsed, error) {
+	timer, err := t.r.GetTimer(ctx, chatID)
+	if err != nil {
+		return models.WebHookParsed{}, err
+	}
+	wp := models.WebHookParsed{
+		ChatID:    chatID,
+		TaskID:    timer.TaskID,
+		Task:      timer.Task,
+		ProjectID: timer.ProjectID,
+		SectionID: timer.SectionID,
+		Labels:    timer.Labels,
+		Priority:  timer.Priority,
+	}
+	if timer.TaskID != "" {
+		todoistID, err := t.r.GetTodoistIDByChat(ctx, chatID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return models.WebHookParsed{}, err
+		}
+		wp.UserID = todoistID
+	}
+	return t.stop(ctx, timer, wp)
+}
+
+// StopTask stops the timer of the chat if it runs for the task in wp and stores its
+// time with the details of wp, such as the completion time, which ends the measured
+// time. ok is false if no timer runs for the task or wp was completed before the timer
+// started, as a completion recovered late by sync can be; the timer then keeps running.
+func (t *Timers) StopTask(ctx context.Context, wp models.WebHookParsed) (tracked models.WebHookParsed, ok bool, err error) {
+	timer, err := t.r.GetTimer(ctx, wp.ChatID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return wp, false, nil
+	} else if err != nil {
+		return wp, false, err
+	}
+	if timer.TaskID == "" || timer.TaskID != wp.TaskID {
+		return wp, false, nil
+	}
+	if wp.CompletedAt != nil && wp.CompletedAt.Before(timer.StartedAt) {
+		logger.Log.Debug("Completion older than timer",
+			zap.Int64("chat_id", wp.ChatID),
+			zap.String("task_id", wp.TaskID),
+		)
+		return wp, false, nil
+	}
+	tracked, err = t.stop(ctx, timer, wp)
+	if err != nil {
+		return wp, false, err
+	}
+	return tracked, true, nil
+}
+
+// stop stores the time of the timer for wp and then removes the timer. The time is
+// measured up to the completion of wp, or up to now if it has none. The entry is keyed
+// by the timer, so a stop that is repeated after a failed removal is not counted twice;
+// TimerStopped is only set when the time was stored, so the repeat is not announced
+// again either.
+func (t *Timers) stop(ctx context.Context, timer models.Timer, wp models.WebHookParsed) (models.WebHookParsed, error) {
+	end := t.now()
+	if wp.CompletedAt != nil {
+		end = *wp.CompletedAt
+	}
+	wp.TimeSpent = elapsed(timer, end)
+	wp.AskTime = false
+	wp.EventKey = timerEventKey(wp.ChatID, timer)
+	stored, err := t.r.StoreTaskTracked(ctx, wp.ChatID, wp)
+	if err != nil {
+		return wp, err
+	}
+	wp.TimerStopped = stored
+	if stored && t.writer != nil && wp.TaskID != "" && wp.UserID != "" {
+		t.writer.WriteBack(ctx, wp)
+	}
+	if err := t.r.DeleteTimer(ctx, wp.ChatID, timer.StartedAt); err != nil {
+		return wp, err
+	}
+	logger.Log.Debug("Timer stopped",
+		zap.Int64("chat_id", wp.ChatID),
+		zap.String("task_id", wp.TaskID),
+		zap.Uint32("minutes", wp.TimeSpent),
+	)
+	return wp, nil
+}
+
+// elapsed returns the minutes from the start of the timer to end, at least one.
+func elapsed(timer models.Timer, end time.Time) uint32 {
+	minutes := end.Sub(timer.StartedAt).Round(time.Minute) / time.Minute
+	if minutes < 1 {
+		return 1
+	}
+	return uint32(minutes)
+}
+
+func timerEventKey(chatID int64, timer models.Timer) string {
+	return "timer:" + strconv.FormatInt(chatID, 10) + ":" + timer.StartedAt.UTC().Format(time.RFC3339Nano)
+}
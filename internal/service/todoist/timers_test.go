@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTimerRepository keeps timers in memory on top of the webhook fake.
+type fakeTimerRepository struct {
+	*fakeRepository
+	timersMu  sync.Mutex
+	timers    map[int64]models.Timer
+	deleteErr error
+}
+
+func newFakeTimerRepository() *fakeTimerRepository {
+	return &fakeTimerRepository{
+		fakeRepository: newFakeRepository(),
+		timers:         make(map[int64]models.Timer),
+	}
+}
+
+func (f *fakeTimerRepository) StartTimer(ctx context.Context, chatID int64, timer models.Timer) (bool, error) {
+	f.timersMu.Lock()
+	defer f.timersMu.Unlock()
+	if _, ok := f.timers[chatID]; ok {
+		return false, nil
+	}
+	f.timers[chatID] = timer
+	return true, nil
+}
+
+func (f *fakeTimerRepository) GetTimer(ctx context.Context, chatID int64) (models.Timer, error) {
+	f.timersMu.Lock()
+	defer f.timersMu.Unlock()
+	timer, ok := f.timers[chatID]
+	if !ok {
+		return models.Timer{}, repository.ErrNotFound
+	}
+	return timer, nil
+}
+
+func (f *fakeTimerRepository) DeleteTimer(ctx context.Context, chatID int64, startedAt time.Time) error {
+	f.timersMu.Lock()
+	defer f.timersMu.Unlock()
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	if f.timers[chatID].StartedAt.Equal(startedAt) {
+		delete(f.timers, chatID)
+	}
+	return nil
+}
+
+func (f *fakeTimerRepository) GetTodoistIDByChat(ctx context.Context, chatID int64) (string, error) {
+	return "user123", nil
+}
+
+func newTestTimers(repo TimerRepository, now *time.Time) *Timers {
+	timers := NewTimers(repo, nil)
+	timers.now = func() time.Time { return *now }
+	return timers
+}
+
+func TestTimers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+
+	_, err := timers.Stop(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	timer, started, err := timers.Start(ctx, testChatID, models.Timer{TaskID: "task1", Task: "Write report"})
+	assert.NoError(t, err)
+	assert.True(t, started)
+	assert.Equal(t, now, timer.StartedAt)
+
+	now = now.Add(10 * time.Minute)
+	running, started, err := timers.Start(ctx, testChatID, models.Timer{Task: "Other"})
+	assert.NoError(t, err)
+	assert.False(t, started)
+	assert.Equal(t, "Write report", running.Task)
+
+	status, err := timers.Status(ctx, testChatID)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(10), timers.Elapsed(status))
+
+	now = now.Add(35*time.Minute + 20*time.Second)
+	stopped, err := timers.Stop(ctx, testChatID)
+	assert.NoError(t, err)
+	assert.True(t, stopped.TimerStopped)
+	assert.Equal(t, "user123", stopped.UserID)
+	assert.Equal(t, uint32(45), stopped.TimeSpent)
+	if assert.Len(t, repo.tracked, 1) {
+		assert.Equal(t, "task1", repo.tracked[0].TaskID)
+		assert.Equal(t, uint32(45), repo.tracked[0].TimeSpent)
+		assert.Equal(t, "timer:42:2025-04-10T09:00:00Z", repo.tracked[0].EventKey)
+	}
+
+	_, err = timers.Status(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+
+	// a short timer still counts
+	_, _, err = timers.Start(ctx, testChatID, models.Timer{Task: "Quick call"})
+	assert.NoError(t, err)
+	now = now.Add(10 * time.Second)
+	stopped, err = timers.Stop(ctx, testChatID)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), stopped.TimeSpent)
+	assert.Empty(t, stopped.UserID)
+}
+
+func TestWebHookHandler_completionStopsTimer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+	updates := make(chan models.WebHookParsed, 2)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, timers)
+
+	_, _, err := timers.Start(ctx, testChatID, models.Timer{TaskID: "task1", Task: "Write report"})
+	assert.NoError(t, err)
+	now = now.Add(25 * time.Minute)
+
+	// another task is tracked from its labels and leaves the timer running
+	completedAt := now
+	other := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task2",
+		Content:     "Other",
+		Labels:      []string{"log15m"},
+		CompletedAt: &completedAt,
+	})
+	assert.NoError(t, wh.processWebHook(ctx, other))
+	assert.Equal(t, uint32(15), (<-updates).TimeSpent)
+	_, err = timers.Status(ctx, testChatID)
+	assert.NoError(t, err)
+
+	// the timer gives the time of its task instead of the labels
+	completion := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Write report",
+		ProjectID:   "project1",
+		Labels:      []string{"log1h"},
+		CompletedAt: &completedAt,
+	})
+	assert.NoError(t, wh.processWebHook(ctx, completion))
+	output := <-updates
+	assert.True(t, output.TimerStopped)
+	assert.Equal(t, testChatID, output.ChatID)
+	assert.Equal(t, uint32(25), output.TimeSpent)
+	assert.Equal(t, "project1", output.ProjectID)
+	assert.Equal(t, completedAt, *output.CompletedAt)
+	assert.Len(t, repo.tracked, 2)
+
+	_, err = timers.Status(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestWebHookHandler_completionStopsTimerOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+	updates := make(chan models.WebHookParsed, 2)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, timers)
+
+	_, _, err := timers.Start(ctx, testChatID, models.Timer{TaskID: "task1", Task: "Write report"})
+	assert.NoError(t, err)
+	completedAt := now.Add(40 * time.Minute)
+	completion := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Write report",
+		CompletedAt: &completedAt,
+	})
+
+	// the timer is not removed, so the inbox retries the completion later
+	repo.deleteErr = errors.New("db down")
+	now = now.Add(50 * time.Minute)
+	assert.Error(t, wh.processWebHook(ctx, completion))
+	assert.Empty(t, updates)
+
+	repo.deleteErr = nil
+	now = now.Add(30 * time.Minute)
+	assert.NoError(t, wh.processWebHook(ctx, completion))
+	assert.Empty(t, updates, "the time stored by the first attempt is not stored or announced again")
+	if assert.Len(t, repo.tracked, 1) {
+		assert.Equal(t, uint32(40), repo.tracked[0].TimeSpent, "measured up to the completion")
+	}
+	_, err = timers.Status(ctx, testChatID)
+	assert.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestWebHookHandler_earlierCompletionKeepsTimer(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 10, 9, 0, 0, 0, time.UTC)
+	repo := newFakeTimerRepository()
+	timers := newTestTimers(repo, &now)
+	updates := make(chan models.WebHookParsed, 2)
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, timers)
+
+	_, _, err := timers.Start(ctx, testChatID, models.Timer{TaskID: "task1", Task: "Write report"})
+	assert.NoError(t, err)
+	now = now.Add(20 * time.Minute)
+
+	// a completion from before the timer, recovered late by sync, is tracked from its
+	// labels
+	completedAt := now.Add(-time.Hour)
+	completion := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Write report",
+		Labels:      []string{"log15m"},
+		CompletedAt: &completedAt,
+	})
+	assert.NoError(t, wh.processWebHook(ctx, completion))
+	output := <-updates
+	assert.False(t, output.TimerStopped)
+	assert.Equal(t, uint32(15), output.TimeSpent)
+
+	timer, err := timers.Status(ctx, testChatID)
+	assert.NoError(t, err)
+	assert.Equal(t, "task1", timer.TaskID)
+}
@@ -0,0 +1,534 @@
+// Package todoisttest provides an in-process fake of the Todoist OAuth and sync API
+// for tests, along with a helper to deliver signed webhooks.
+package todoisttest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/models"
+)
+
+// Comment is a comment added to a task through the fake.
+type Comment struct {
+	TaskID  string `json:"task_id"`
+	Content string `json:"content"`
+}
+
+// Server is a fake Todoist. Close it when the test is done.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	mu         sync.Mutex
+	callback   string
+	codes      map[string]bool
+	tokens     map[string]bool
+	sync       models.InitSyncReq
+	syncTokens []string
+	completed  []models.Task
+	comments   []Comment
+	projects   map[string]models.Project
+	added      []models.Task
+	tasks      map[string]models.Task
+	updates    map[string][]map[string]any
+	onClose    func(task models.Task)
+	deliveries int
+}
+
+// New starts a fake Todoist that accepts the given OAuth client credentials.
+func New(clientID, clientSecret string) *Server {
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		codes:        make(map[string]bool),
+		tokens:       make(map[string]bool),
+		updates:      make(map[string][]map[string]any),
+		projects:     make(map[string]models.Project),
+		tasks:        make(map[string]models.Task),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth/authorize", s.handleAuthorize)
+	mux.HandleFunc("POST /oauth/access_token", s.handleToken)
+	mux.HandleFunc("DELETE /api/v1/access_tokens", s.handleRevoke)
+	mux.HandleFunc("POST /api/v1/sync", s.handleSync)
+	mux.HandleFunc("GET /api/v1/tasks/completed/by_completion_date", s.handleCompleted)
+	mux.HandleFunc("POST /api/v1/comments", s.handleAddComment)
+	mux.HandleFunc("POST /api/v1/tasks/quick", s.handleQuickAdd)
+	mux.HandleFunc("GET /api/v1/projects", s.handleGetProjects)
+	mux.HandleFunc("GET /api/v1/projects/{id}", s.handleGetProject)
+	mux.HandleFunc("GET /api/v1/tasks/{id}", s.handleGetTask)
+	mux.HandleFunc("GET /api/v1/tasks/filter", s.handleFilter)
+	mux.HandleFunc("POST /api/v1/tasks/{id}/close", s.handleClose)
+	mux.HandleFunc("POST /api/v1/tasks/{id}", s.handleUpdateTask)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AuthURL is the OAuth authorization page.
+func (s *Server) AuthURL() string {
+	return s.URL + "/oauth/authorize"
+}
+
+// TokenURL is the OAuth token exchange endpoint.
+func (s *Server) TokenURL() string {
+	return s.URL + "/oauth/access_token"
+}
+
+// APIURL is the base of the API.
+func (s *Server) APIURL() string {
+	return s.URL + "/api/v1"
+}
+
+// SetCallback sets the redirect URI of the OAuth app, where the authorization page
+// sends the user back with a code.
+func (s *Server) SetCallback(callback string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callback = callback
+}
+
+// SetSync sets the response of the sync endpoint. Only tokens issued through the OAuth
+// flow or AddToken are accepted.
+func (s *Server) SetSync(resp models.InitSyncReq) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sync = resp
+}
+
+// SetCompleted sets the tasks returned by the completed tasks endpoint. Each task needs
+// CompletedAt to be set.
+func (s *Server) SetCompleted(tasks []models.Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed = tasks
+}
+
+// AddTask makes the task known to the fake.
+func (s *Server) AddTask(task models.Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[task.ID] = task
+}
+
+// Task returns the task as the fake knows it.
+func (s *Server) Task(taskID string) models.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tasks[taskID]
+}
+
+// OnClose sets a function called with the task each time a task is closed, before the
+// close request returns. Tests use it to deliver the completion webhook early.
+func (s *Server) OnClose(fn func(task models.Task)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onClose = fn
+}
+
+// AddProject makes the project known to the fake.
+func (s *Server) AddProject(project models.Project) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.projects[project.ID] = project
+}
+
+// Added returns the tasks created through quick add so far.
+func (s *Server) Added() []models.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.Task(nil), s.added...)
+}
+
+// Comments returns the comments added so far.
+func (s *Server) Comments() []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Comment(nil), s.comments...)
+}
+
+// TaskUpdates returns the bodies of the update requests of the task so far.
+func (s *Server) TaskUpdates(taskID string) []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]any(nil), s.updates[taskID]...)
+}
+
+// SyncTokens returns the sync_token of every sync request so far.
+func (s *Server) SyncTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.syncTokens...)
+}
+
+// AddToken makes the fake accept token as if it was issued through the OAuth flow.
+func (s *Server) AddToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = true
+}
+
+// Tokens returns the access tokens issued so far that are not revoked.
+func (s *Server) Tokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens := make([]string, 0, len(s.tokens))
+	for token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// handleAuthorize approves every request of the known client, as if the user pressed
+// "Agree" at once.
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != s.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	if query.Has("client_secret") {
+		http.Error(w, "client secret must not be sent to the browser", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	callback := s.callback
+	code := randomString()
+	s.codes[code] = true
+	s.mu.Unlock()
+	if callback == "" {
+		http.Error(w, "no redirect uri set", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, callback+"?"+url.Values{
+		"code":  {code},
+		"state": {query.Get("state")},
+	}.Encode(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("client_id") != s.ClientID || r.Form.Get("client_secret") != s.ClientSecret {
+		http.Error(w, "invalid client credentials", http.StatusUnauthorized)
+		return
+	}
+	code := r.Form.Get("code")
+	s.mu.Lock()
+	ok := s.codes[code]
+	delete(s.codes, code)
+	token := randomString()
+	if ok {
+		s.tokens[token] = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, models.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+	})
+}
+
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != s.ClientID || query.Get("client_secret") != s.ClientSecret {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	delete(s.tokens, query.Get("access_token"))
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	ok = ok && s.tokens[token]
+	resp := s.sync
+	if ok {
+		s.syncTokens = append(s.syncTokens, r.FormValue("sync_token"))
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleCompleted(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, "invalid since", http.StatusBadRequest)
+		return
+	}
+	until, err := time.Parse(time.RFC3339, r.URL.Query().Get("until"))
+	if err != nil {
+		http.Error(w, "invalid until", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	ok = ok && s.tokens[token]
+	items := make([]models.Task, 0)
+	for _, task := range s.completed {
+		if !task.CompletedAt.Before(since) && task.CompletedAt.Before(until) {
+			items = append(items, task)
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"items":       items,
+		"next_cursor": nil,
+	})
+}
+
+// authorized reports whether the request carries a token issued by the fake.
+func (s *Server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ok && s.tokens[token]
+}
+
+func (s *Server) handleAddComment(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	comment := Comment{}
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil || comment.TaskID == "" {
+		http.Error(w, "invalid comment", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.comments = append(s.comments, comment)
+	s.mu.Unlock()
+	writeJSON(w, comment)
+}
+
+func (s *Server) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	update := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+	taskID := r.PathValue("id")
+	s.mu.Lock()
+	s.updates[taskID] = append(s.updates[taskID], update)
+	if task, ok := s.tasks[taskID]; ok {
+		if labels, ok := update["labels"].([]any); ok {
+			task.Labels = task.Labels[:0:0]
+			for _, label := range labels {
+				if label, ok := label.(string); ok {
+					task.Labels = append(task.Labels, label)
+				}
+			}
+			s.tasks[taskID] = task
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, models.Task{ID: taskID})
+}
+
+// handleQuickAdd only understands a trailing #project; the rest of the text is the
+// task content.
+func (s *Server) handleQuickAdd(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	req := struct {
+		Text string `json:"text"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		http.Error(w, "invalid text", http.StatusBadRequest)
+		return
+	}
+	task := models.Task{ID: randomString(), Content: req.Text, ProjectID: "inbox"}
+	s.mu.Lock()
+	if i := strings.LastIndex(req.Text, " #"); i >= 0 {
+		for _, project := range s.projects {
+			if project.Name == req.Text[i+2:] {
+				task.Content = req.Text[:i]
+				task.ProjectID = project.ID
+			}
+		}
+	}
+	s.added = append(s.added, task)
+	s.mu.Unlock()
+	writeJSON(w, task)
+}
+
+// handleGetProjects returns all projects in a single page.
+func (s *Server) handleGetProjects(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	results := make([]models.Project, 0, len(s.projects))
+	for _, project := range s.projects {
+		results = append(results, project)
+	}
+	s.mu.Unlock()
+	writeJSON(w, map[string]any{
+		"results":     results,
+		"next_cursor": nil,
+	})
+}
+
+func (s *Server) handleGetProject(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	project, ok := s.projects[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "project not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, project)
+}
+
+func (s *Server) handleGetTask(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	task, ok := s.tasks[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, task)
+}
+
+// handleFilter does not evaluate the query, it returns every active task with a due date.
+func (s *Server) handleFilter(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	results := make([]models.Task, 0)
+	for _, task := range s.tasks {
+		if !task.Checked && task.Due != nil {
+			results = append(results, task)
+		}
+	}
+	s.mu.Unlock()
+	slices.SortFunc(results, func(a, b models.Task) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	writeJSON(w, map[string]any{
+		"results":     results,
+		"next_cursor": nil,
+	})
+}
+
+func (s *Server) handleClose(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	task, ok := s.tasks[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		http.Error(w, "task not found", http.StatusNotFound)
+		return
+	}
+	completedAt := time.Now().UTC().Truncate(time.Microsecond)
+	task.Checked = true
+	task.CompletedAt = &completedAt
+	s.tasks[task.ID] = task
+	onClose := s.onClose
+	s.mu.Unlock()
+	if onClose != nil {
+		onClose(task)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Sign returns the X-Todoist-Hmac-SHA256 header value for body.
+func (s *Server) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.ClientSecret))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookRequest returns a signed webhook delivery of event to target, with a new
+// delivery ID.
+func (s *Server) WebhookRequest(target string, event models.WebHookRequest) (*http.Request, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.deliveries++
+	deliveryID := strconv.Itoa(s.deliveries)
+	s.mu.Unlock()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Todoist-Hmac-SHA256", s.Sign(body))
+	req.Header.Set("X-Todoist-Delivery-ID", deliveryID)
+	req.Header.Set("User-Agent", "Todoist-Webhooks")
+	return req, nil
+}
+
+// SendWebhook delivers event to target the way Todoist does.
+func (s *Server) SendWebhook(target string, event models.WebHookRequest) (*http.Response, error) {
+	req, err := s.WebhookRequest(target, event)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
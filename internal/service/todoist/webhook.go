@@ -1,40 +1,107 @@
 package handler
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"regexp"
-	"strconv"
-	"sync"
+	"time"
 
 	"example.com/bot/internal/logger"
 	l "example.com/bot/internal/logger"
 	"example.com/bot/internal/models"
+	"example.com/bot/internal/repository"
+	"example.com/bot/pkg/duration"
 	"go.uber.org/zap"
 )
 
 const (
-	itemUpdateEvent      = "item:completed"
-	regexpTimeLogPattern = `^log(?P<hours_10>\d+)(?P<hours_1>\d+)(?P<mins_10>\d+)(?P<mins_1>\d+)$`
+	itemCompletedEvent   = "item:completed"
+	itemUncompletedEvent = "item:uncompleted"
+	hmacHeader           = "X-Todoist-Hmac-SHA256"
+	deliveryIDHeader     = "X-Todoist-Delivery-ID"
+	notifyTimeout        = 10 * time.Second
+	// trackLabel asks for the time of the task in the chat once it is completed.
+	trackLabel = "track"
 )
 
+// InternalLabels returns the labels that only tell the service what to do with a task,
+// doingLabel being the one that runs its timer. They are no category of their own.
+func InternalLabels(doingLabel string) []string {
+	return []string{trackLabel, doingLabel}
+}
+
+var (
+	errMissingSignature = errors.New("missing webhook signature")
+	errInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// WebHookRepository is the storage used by the webhook inbox and event processing.
+type WebHookRepository interface {
+	EnqueueWebHook(ctx context.Context, payload []byte, deliveryID, eventKey string) (bool, error)
+	ClaimWebHooks(ctx context.Context, limit int, lease time.Duration) ([]models.InboxItem, error)
+	CompleteWebHook(ctx context.Context, id int64) error
+	RetryWebHook(ctx context.Context, id int64, retryAt time.Time, reason string) error
+	BuryWebHook(ctx context.Context, id int64, reason string) error
+	GetChatIDByTodoist(ctx context.Context, todoistUserID string) (int64, error)
+	StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) (bool, error)
+	RevertTaskTracked(ctx context.Context, chatID int64, taskID string) (models.TaskShow, bool, error)
+}
+
 type WebHookHandler struct {
-	u chan<- models.WebHookParsed
+	u            chan<- models.WebHookParsed
+	clientSecret []byte
+	r            WebHookRepository
+	writer       TrackedWriter
+	timers       *Timers
+	router       *EventRouter
+	wake         chan struct{}
+}
 
-	r           *regexp.Regexp
-	subexpNames []string
-	wg          *sync.WaitGroup
+// NewWebHookHandler returns the webhook endpoint and inbox worker. writer, if not nil,
+// is told about every task whose time was stored. timers, if not nil, are stopped when
+// their task is completed.
+func NewWebHookHandler(updates chan<- models.WebHookParsed, clientSecret string, r WebHookRepository, writer TrackedWriter, timers *Timers) *WebHookHandler {
+	wh := &WebHookHandler{
+		u:            updates,
+		clientSecret: []byte(clientSecret),
+		r:            r,
+		writer:       writer,
+		timers:       timers,
+		router:       NewEventRouter(),
+		wake:         make(chan struct{}, 1),
+	}
+	wh.router.Register(itemCompletedEvent, EventHandlerFunc(wh.handleCompleted))
+	wh.router.Register(itemUncompletedEvent, EventHandlerFunc(wh.revert))
+	return wh
+}
+
+// Router returns the router used for stored webhook events, so more handlers can be registered.
+func (wh *WebHookHandler) Router() *EventRouter {
+	return wh.router
 }
 
-func NewWebHookHandler(updates chan<- models.WebHookParsed) *WebHookHandler {
-	r := regexp.MustCompile(regexpTimeLogPattern)
-	return &WebHookHandler{
-		u:           updates,
-		r:           r,
-		subexpNames: r.SubexpNames(),
-		wg:          &sync.WaitGroup{},
+// verifySignature checks the X-Todoist-Hmac-SHA256 header, which Todoist sets to
+// base64(HMAC-SHA256(client_secret, body)).
+func (wh *WebHookHandler) verifySignature(signature string, body []byte) error {
+	if signature == "" {
+		return errMissingSignature
+	}
+	got, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errInvalidSignature
+	}
+	mac := hmac.New(sha256.New, wh.clientSecret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errInvalidSignature
 	}
+	return nil
 }
 
 func (wh *WebHookHandler) handleHTTP(w http.ResponseWriter, r *http.Request) {
@@ -45,37 +112,86 @@ func (wh *WebHookHandler) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		zap.String("remote address", r.RemoteAddr),
 	)
 	log.Debug("Recieve webhook request")
-	req := models.WebHookRequest{}
 	defer r.Body.Close()
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		rBytes, _ := io.ReadAll(r.Body)
-		log.Error("Unexpecter request body",
-			zap.String("body", string(rBytes)),
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Error("Error reading request body",
+			zap.Error(err),
 		)
 		w.WriteHeader(http.StatusBadRequest) // 400
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	if err := wh.verifySignature(r.Header.Get(hmacHeader), body); err != nil {
+		log.Warn("Rejected webhook request",
+			zap.Error(err),
+		)
+		w.WriteHeader(http.StatusUnauthorized) // 401
+		return
+	}
+
+	req := models.WebHookRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		log.Error("Unexpecter request body",
+			zap.String("body", string(body)),
+		)
+		w.WriteHeader(http.StatusBadRequest) // 400
+		return
+	}
 
 	log.Debug("Webhook request",
 		zap.Any("request", req),
 	)
 
-	wh.wg.Add(1)
-	go wh.processWebHook(&req)
-	// wh.u <- req
-
+	// Todoist retries deliveries that are not acknowledged, so only answer 200
+	// once the event is durably stored.
+	deliveryID := r.Header.Get(deliveryIDHeader)
+	enqueued, err := wh.r.EnqueueWebHook(r.Context(), body, deliveryID, eventKey(&req))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if !enqueued {
+		log.Debug("Duplicate webhook delivery",
+			zap.String("delivery_id", deliveryID),
+		)
+		return
+	}
+	wh.wakeWorker()
 }
 
-func (wh *WebHookHandler) processWebHook(req *models.WebHookRequest) {
-	defer wh.wg.Done()
+// Enqueue stores an event that did not come through the webhook, such as a completion
+// found by the sync worker, for processing like a webhook. It returns false if the same
+// event was already stored.
+func (wh *WebHookHandler) Enqueue(ctx context.Context, req *models.WebHookRequest) (bool, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return false, err
+	}
+	enqueued, err := wh.r.EnqueueWebHook(ctx, payload, "", eventKey(req))
+	if err != nil || !enqueued {
+		return false, err
+	}
+	wh.wakeWorker()
+	return true, nil
+}
 
-	if req.EventName != itemUpdateEvent {
-		logger.Log.Debug("wtf")
-		return
+func (wh *WebHookHandler) wakeWorker() {
+	select {
+	case wh.wake <- struct{}{}:
+	default:
 	}
+}
+
+// processWebHook passes a stored webhook event to its handler. A returned error means
+// the event should be retried later.
+func (wh *WebHookHandler) processWebHook(ctx context.Context, req *models.WebHookRequest) error {
+	return wh.router.Dispatch(ctx, req)
+}
 
+// handleCompleted turns a completed task into tracked time.
+func (wh *WebHookHandler) handleCompleted(ctx context.Context, req *models.WebHookRequest) error {
 	wp := models.WebHookParsed{
 		UserID:    req.UserID,
 		TimeSpent: 0,
@@ -88,10 +204,23 @@ func (wh *WebHookHandler) processWebHook(req *models.WebHookRequest) {
 		logger.Log.Error("error in unmarshaling",
 			zap.Error(err),
 		)
-		return
+		return err
 	}
 
+	wp.TaskID = task.ID
 	wp.Task = task.Content
+	wp.EventKey = taskEventKey(req.EventName, task)
+	wp.ProjectID = task.ProjectID
+	wp.SectionID = task.SectionID
+	wp.Labels = task.Labels
+	wp.Priority = task.Priority
+	wp.CompletedAt = task.CompletedAt
+	if wh.timers != nil {
+		stopped, err := wh.stopTimer(ctx, wp)
+		if err != nil || stopped {
+			return err
+		}
+	}
 	if task.Duration != nil {
 		switch task.Duration.Unit {
 		case "minute":
@@ -99,58 +228,179 @@ func (wh *WebHookHandler) processWebHook(req *models.WebHookRequest) {
 		case "day":
 			wp.TimeSpent += uint32(task.Duration.Amount) * 24 * 60
 		}
-		logger.Log.Debug("wirte to chan")
-		wh.u <- wp
-		return
+		return wh.track(ctx, wp)
 	}
 
 	if len(task.Labels) == 0 {
 		logger.Log.Debug("impossible")
-		return
+		return nil
 	}
 
-	var matches []string
 	for _, label := range task.Labels {
-		if label == "track" {
+		if label == trackLabel {
 			wp.AskTime = true
-			logger.Log.Debug("wirte to chan")
-			wh.u <- wp
-			return
+			return wh.track(ctx, wp)
+		}
+		minutes, ok, err := duration.ParseLabel(label)
+		if err != nil {
+			logger.Log.Warn("Malformed log label",
+				zap.String("label", label),
+				zap.Error(err),
+			)
+			continue
 		}
-		matchesTmp := wh.r.FindStringSubmatch(label)
-		if matchesTmp != nil {
-			matches = matchesTmp
-			break
+		if ok {
+			wp.TimeSpent = minutes
+			return wh.track(ctx, wp)
 		}
 	}
+	return nil
+}
 
-	if matches == nil {
-		return
+// track stores the parsed event for the linked chat and tells the bot about it.
+// Events that need a time from the user are only handed to the bot.
+func (wh *WebHookHandler) track(ctx context.Context, wp models.WebHookParsed) error {
+	chatID, ok, err := wh.chatID(ctx, wp.UserID)
+	if !ok {
+		return err
 	}
+	wp.ChatID = chatID
 
-	result := make(map[string]uint32)
-	for i, name := range wh.subexpNames {
-		if i > 0 && name != "" && i < len(matches) {
-			dig, err := strconv.Atoi(matches[i])
-			if err != nil {
-				panic(err)
-			}
-			result[name] = uint32(dig)
-		}
+	if wp.AskTime {
+		return wh.notify(ctx, wp)
+	}
+	stored, err := wh.r.StoreTaskTracked(ctx, chatID, wp)
+	if err != nil {
+		return err
+	}
+	if !stored {
+		logger.Log.Debug("Task completion already tracked",
+			zap.String("event_key", wp.EventKey),
+		)
+		return nil
 	}
+	if wh.writer != nil {
+		wh.writer.WriteBack(ctx, wp)
+	}
+	if err := wh.notify(ctx, wp); err != nil {
+		// the time is already stored, retrying would only repeat the message
+		logger.Log.Warn("Tracked task notification dropped",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+	}
+	return nil
+}
 
-	for key, val := range result {
-		switch key {
-		case "hours_10":
-			wp.TimeSpent += val * 600
-		case "hours_1":
-			wp.TimeSpent += val * 60
-		case "mins_10":
-			wp.TimeSpent += val * 10
-		case "mins_1":
-			wp.TimeSpent += val
-		}
+// stopTimer stores the time of a timer running for the completed task instead of the
+// time from its duration or labels. It returns false if no timer runs for the task.
+func (wh *WebHookHandler) stopTimer(ctx context.Context, wp models.WebHookParsed) (bool, error) {
+	chatID, ok, err := wh.chatID(ctx, wp.UserID)
+	if !ok {
+		return false, err
+	}
+	wp.ChatID = chatID
+	tracked, ok, err := wh.timers.StopTask(ctx, wp)
+	if !ok {
+		return false, err
+	}
+	if !tracked.TimerStopped {
+		// stored by an earlier attempt
+		return true, nil
+	}
+	if err := wh.notify(ctx, tracked); err != nil {
+		logger.Log.Warn("Stopped timer notification dropped",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+	}
+	return true, nil
+}
+
+// revert takes back the time tracked for a task that was unchecked in Todoist.
+func (wh *WebHookHandler) revert(ctx context.Context, req *models.WebHookRequest) error {
+	task := &models.Task{}
+	if err := json.Unmarshal(req.EventData, task); err != nil {
+		logger.Log.Error("error in unmarshaling",
+			zap.Error(err),
+		)
+		return err
+	}
+	chatID, ok, err := wh.chatID(ctx, req.UserID)
+	if !ok {
+		return err
 	}
+	reverted, ok, err := wh.r.RevertTaskTracked(ctx, chatID, task.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		logger.Log.Debug("Nothing tracked for uncompleted task",
+			zap.String("task_id", task.ID),
+		)
+		return nil
+	}
+	wp := models.WebHookParsed{
+		UserID:    req.UserID,
+		ChatID:    chatID,
+		TaskID:    task.ID,
+		Task:      reverted.Task,
+		TimeSpent: uint32(reverted.TimeSpent),
+		Reverted:  true,
+	}
+	if err := wh.notify(ctx, wp); err != nil {
+		logger.Log.Warn("Reverted task notification dropped",
+			zap.Int64("chat_id", chatID),
+			zap.Error(err),
+		)
+	}
+	return nil
+}
+
+// chatID finds the chat linked to the Todoist user. ok is false when there is nothing
+// to do, either because of err or because no chat is linked.
+func (wh *WebHookHandler) chatID(ctx context.Context, todoistUserID string) (int64, bool, error) {
+	chatID, err := wh.r.GetChatIDByTodoist(ctx, todoistUserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		logger.Log.Warn("Webhook for todoist user without chat",
+			zap.String("todoist_id", todoistUserID),
+		)
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return chatID, true, nil
+}
+
+func (wh *WebHookHandler) notify(ctx context.Context, wp models.WebHookParsed) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
 	logger.Log.Debug("wirte to chan")
-	wh.u <- wp
+	select {
+	case wh.u <- wp:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("bot did not accept update: %w", ctx.Err())
+	}
+}
+
+// eventKey identifies the task completion carried by req. Redeliveries and other sources
+// of the same completion share the key, while a later completion of the same task does not.
+// Events other than completions have no key.
+func eventKey(req *models.WebHookRequest) string {
+	if req.EventName != itemCompletedEvent {
+		return ""
+	}
+	task := &models.Task{}
+	if err := json.Unmarshal(req.EventData, task); err != nil {
+		return ""
+	}
+	return taskEventKey(req.EventName, task)
+}
+
+func taskEventKey(eventName string, task *models.Task) string {
+	if eventName != itemCompletedEvent || task.ID == "" || task.CompletedAt == nil {
+		return ""
+	}
+	return eventName + ":" + task.ID + ":" + task.CompletedAt.UTC().Format(time.RFC3339)
 }
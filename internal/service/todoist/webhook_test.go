@@ -2,9 +2,16 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -107,62 +114,115 @@ func TestWebHookHandler_processWebHook(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			updates := make(chan models.WebHookParsed, 1)
-			wh := NewWebHookHandler(updates)
+			repo := newFakeRepository()
+			wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
 
-			wh.wg.Add(1)
-			go wh.processWebHook(tt.requestBody)
+			err := wh.processWebHook(context.Background(), tt.requestBody)
+			assert.NoError(t, err)
 
 			if tt.shouldSendToChannel {
 				var output models.WebHookParsed
 				select {
 				case output = <-updates:
 					assert.Equal(t, tt.expectedOutput.UserID, output.UserID)
+					assert.Equal(t, testChatID, output.ChatID)
 					assert.Equal(t, tt.expectedOutput.Task, output.Task)
 					assert.Equal(t, tt.expectedOutput.TimeSpent, output.TimeSpent)
 					assert.Equal(t, tt.expectedOutput.AskTime, output.AskTime)
 				case <-time.After(100 * time.Millisecond):
 					t.Fatal("Timeout waiting for webhook processing")
 				}
+				if tt.expectedOutput.AskTime {
+					assert.Empty(t, repo.tracked)
+				} else {
+					assert.Len(t, repo.tracked, 1)
+				}
 			} else {
 				select {
 				case <-updates:
 					t.Fatal("Unexpected output received from webhook processing")
 				case <-time.After(100 * time.Millisecond):
 				}
+				assert.Empty(t, repo.tracked)
 			}
 		})
 	}
 }
 
 func TestWebHookHandler_handleHTTP(t *testing.T) {
+	validRequest := createWebhookRequestRaw("item:completed", "user123", models.Task{
+		ID:      "task1",
+		Content: "Test Task",
+		Duration: &models.Duration{
+			Amount: 30,
+			Unit:   "minute",
+		},
+	})
+
 	tests := []struct {
 		name           string
 		requestBody    interface{}
+		signature      func(body []byte) string
 		expectedStatus int
+		enqueueErr     error
 	}{
 		{
-			name: "Valid request",
-			requestBody: createWebhookRequestRaw("item:completed", "user123", models.Task{
-				ID:      "task1",
-				Content: "Test Task",
-				Duration: &models.Duration{
-					Amount: 30,
-					Unit:   "minute",
-				},
-			}),
+			name:           "Valid request",
+			requestBody:    validRequest,
+			signature:      signBody,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "Inbox unavailable",
+			requestBody:    validRequest,
+			signature:      signBody,
+			enqueueErr:     errors.New("db is down"),
+			expectedStatus: http.StatusInternalServerError,
+		},
 		{
 			name:           "Invalid request body",
 			requestBody:    "invalid json",
+			signature:      signBody,
 			expectedStatus: http.StatusBadRequest,
 		},
+		{
+			name:           "Missing signature",
+			requestBody:    validRequest,
+			signature:      func([]byte) string { return "" },
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "Tampered body",
+			requestBody: validRequest,
+			signature: func(body []byte) string {
+				return signBody(bytes.Replace(body, []byte("user123"), []byte("user999"), 1))
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:        "Signature with wrong secret",
+			requestBody: validRequest,
+			signature: func(body []byte) string {
+				mac := hmac.New(sha256.New, []byte("other-secret"))
+				mac.Write(body)
+				return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Malformed signature",
+			requestBody:    validRequest,
+			signature:      func([]byte) string { return "not base64!" },
+			expectedStatus: http.StatusUnauthorized,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			updates := make(chan models.WebHookParsed, 1)
-			wh := NewWebHookHandler(updates)
+			repo := newFakeRepository()
+			repo.enqueueErr = tt.enqueueErr
+			wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
 
 			handler := http.HandlerFunc(wh.handleHTTP)
 
@@ -178,16 +238,351 @@ func TestWebHookHandler_handleHTTP(t *testing.T) {
 
 			req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
 			req.Header.Set("Content-Type", "application/json")
+			if sig := tt.signature(body); sig != "" {
+				req.Header.Set(hmacHeader, sig)
+			}
 
 			recorder := httptest.NewRecorder()
 
 			handler.ServeHTTP(recorder, req)
 
 			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, [][]byte{body}, repo.enqueued)
+			} else {
+				assert.Empty(t, repo.enqueued)
+			}
 		})
 	}
 }
 
+func TestWebHookHandler_processInboxItem(t *testing.T) {
+	payload, _ := json.Marshal(createWebhookRequestRaw("item:completed", "user123", models.Task{
+		ID:      "task1",
+		Content: "Test Task",
+		Labels:  []string{"log0030"},
+	}))
+
+	tests := []struct {
+		name          string
+		attempts      int
+		payload       []byte
+		storeErr      error
+		wantCompleted bool
+		wantRetry     bool
+		wantBuried    bool
+	}{
+		{
+			name:          "Processed",
+			attempts:      1,
+			payload:       payload,
+			wantCompleted: true,
+		},
+		{
+			name:      "Store failure is retried",
+			attempts:  1,
+			payload:   payload,
+			storeErr:  errors.New("db is down"),
+			wantRetry: true,
+		},
+		{
+			name:       "Store failure after max attempts is buried",
+			attempts:   inboxMaxAttempts,
+			payload:    payload,
+			storeErr:   errors.New("db is down"),
+			wantBuried: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan models.WebHookParsed, 1)
+			repo := newFakeRepository()
+			repo.storeErr = tt.storeErr
+			wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
+
+			before := time.Now()
+			wh.processInboxItem(context.Background(), models.InboxItem{ID: 7, Payload: tt.payload, Attempts: tt.attempts})
+
+			assert.Equal(t, tt.wantCompleted, repo.completed[7])
+			assert.Equal(t, tt.wantBuried, repo.buried[7])
+			retryAt, retried := repo.retries[7]
+			assert.Equal(t, tt.wantRetry, retried)
+			if retried {
+				assert.WithinDuration(t, before.Add(retryDelay(tt.attempts)), retryAt, time.Second)
+			}
+		})
+	}
+}
+
+func TestWebHookHandler_deduplication(t *testing.T) {
+	completedAt := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	completion := createWebhookRequestRaw("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Test Task",
+		Labels:      []string{"log0030"},
+		CompletedAt: &completedAt,
+	})
+	body, _ := json.Marshal(completion)
+
+	send := func(wh *WebHookHandler, body []byte, deliveryID string) int {
+		req := httptest.NewRequest("POST", "/webhook", bytes.NewReader(body))
+		req.Header.Set(hmacHeader, signBody(body))
+		if deliveryID != "" {
+			req.Header.Set(deliveryIDHeader, deliveryID)
+		}
+		recorder := httptest.NewRecorder()
+		wh.handleHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	t.Run("Same delivery ID", func(t *testing.T) {
+		repo := newFakeRepository()
+		wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+
+		other, _ := json.Marshal(createWebhookRequestRaw("item:added", "user123", models.Task{ID: "task2"}))
+		assert.Equal(t, http.StatusOK, send(wh, other, "delivery-1"))
+		assert.Equal(t, http.StatusOK, send(wh, other, "delivery-1"))
+		assert.Len(t, repo.enqueued, 1)
+	})
+
+	t.Run("Same completion without delivery ID", func(t *testing.T) {
+		repo := newFakeRepository()
+		wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+
+		assert.Equal(t, http.StatusOK, send(wh, body, ""))
+		assert.Equal(t, http.StatusOK, send(wh, body, ""))
+		assert.Len(t, repo.enqueued, 1)
+	})
+
+	t.Run("Same completion with new delivery ID", func(t *testing.T) {
+		repo := newFakeRepository()
+		wh := NewWebHookHandler(make(chan models.WebHookParsed, 1), testClientSecret, repo, nil, nil)
+
+		assert.Equal(t, http.StatusOK, send(wh, body, "delivery-1"))
+		assert.Equal(t, http.StatusOK, send(wh, body, "delivery-2"))
+		assert.Len(t, repo.enqueued, 1)
+	})
+
+	t.Run("Tracked once when processed twice", func(t *testing.T) {
+		updates := make(chan models.WebHookParsed, 2)
+		repo := newFakeRepository()
+		wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
+
+		assert.NoError(t, wh.processWebHook(context.Background(), &completion))
+		assert.NoError(t, wh.processWebHook(context.Background(), &completion))
+		assert.Len(t, repo.tracked, 1)
+		assert.Len(t, updates, 1)
+	})
+}
+
+func TestWebHookHandler_taskMetadata(t *testing.T) {
+	completedAt := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	req := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task1",
+		ProjectID:   "project1",
+		SectionID:   "section1",
+		Content:     "Test Task",
+		Priority:    4,
+		Labels:      []string{"work", "log1h"},
+		CompletedAt: &completedAt,
+	})
+
+	updates := make(chan models.WebHookParsed, 1)
+	repo := newFakeRepository()
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
+
+	assert.NoError(t, wh.processWebHook(context.Background(), req))
+	if assert.Len(t, repo.tracked, 1) {
+		tracked := repo.tracked[0]
+		assert.Equal(t, "task1", tracked.TaskID)
+		assert.Equal(t, "project1", tracked.ProjectID)
+		assert.Equal(t, "section1", tracked.SectionID)
+		assert.Equal(t, []string{"work", "log1h"}, tracked.Labels)
+		assert.Equal(t, 4, tracked.Priority)
+		assert.Equal(t, completedAt, *tracked.CompletedAt)
+		assert.Equal(t, uint32(60), tracked.TimeSpent)
+	}
+}
+
+func TestWebHookHandler_uncompleted(t *testing.T) {
+	firstAt := time.Date(2025, 4, 9, 12, 0, 0, 0, time.UTC)
+	completedAt := time.Date(2025, 4, 10, 12, 0, 0, 0, time.UTC)
+	first := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Test Task",
+		Labels:      []string{"log0015"},
+		CompletedAt: &firstAt,
+	})
+	completion := createWebhookRequest("item:completed", "user123", models.Task{
+		ID:          "task1",
+		Content:     "Test Task",
+		Labels:      []string{"log0030"},
+		CompletedAt: &completedAt,
+	})
+	uncompletion := createWebhookRequest("item:uncompleted", "user123", models.Task{
+		ID:      "task1",
+		Content: "Test Task",
+	})
+
+	updates := make(chan models.WebHookParsed, 2)
+	repo := newFakeRepository()
+	wh := NewWebHookHandler(updates, testClientSecret, repo, nil, nil)
+
+	assert.NoError(t, wh.processWebHook(context.Background(), first))
+	<-updates
+	assert.NoError(t, wh.processWebHook(context.Background(), completion))
+	<-updates
+	assert.Len(t, repo.tracked, 2)
+
+	assert.NoError(t, wh.processWebHook(context.Background(), uncompletion))
+	output := <-updates
+	assert.True(t, output.Reverted)
+	assert.Equal(t, "task1", output.TaskID)
+	assert.Equal(t, "Test Task", output.Task)
+	assert.Equal(t, uint32(30), output.TimeSpent)
+
+	// a repeated uncompletion leaves the earlier completion alone
+	assert.NoError(t, wh.processWebHook(context.Background(), uncompletion))
+	assert.Empty(t, updates)
+	assert.Equal(t, map[string]bool{eventKey(completion): true}, repo.reverted)
+}
+
+func TestEventKey(t *testing.T) {
+	completedAt := time.Date(2025, 4, 10, 12, 0, 0, 500, time.FixedZone("UTC+3", 3*60*60))
+	completed := createWebhookRequest("item:completed", "user123", models.Task{ID: "task1", CompletedAt: &completedAt})
+	assert.Equal(t, "item:completed:task1:2025-04-10T09:00:00Z", eventKey(completed))
+
+	noTime := createWebhookRequest("item:completed", "user123", models.Task{ID: "task1"})
+	assert.Empty(t, eventKey(noTime))
+
+	added := createWebhookRequest("item:added", "user123", models.Task{ID: "task1", CompletedAt: &completedAt})
+	assert.Empty(t, eventKey(added))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, inboxRetryBase, retryDelay(1))
+	assert.Equal(t, 2*inboxRetryBase, retryDelay(2))
+	assert.Equal(t, 8*inboxRetryBase, retryDelay(4))
+	assert.Equal(t, inboxRetryMax, retryDelay(100))
+}
+
+const testChatID int64 = 42
+
+type fakeRepository struct {
+	mu         sync.Mutex
+	enqueueErr error
+	storeErr   error
+	enqueued   [][]byte
+	tracked    []models.WebHookParsed
+	reverted   map[string]bool
+	completed  map[int64]bool
+	buried     map[int64]bool
+	retries    map[int64]time.Time
+	seen       map[string]bool
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{
+		seen:      make(map[string]bool),
+		reverted:  make(map[string]bool),
+		completed: make(map[int64]bool),
+		buried:    make(map[int64]bool),
+		retries:   make(map[int64]time.Time),
+	}
+}
+
+func (f *fakeRepository) EnqueueWebHook(ctx context.Context, payload []byte, deliveryID, eventKey string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.enqueueErr != nil {
+		return false, f.enqueueErr
+	}
+	for _, key := range []string{"delivery:" + deliveryID, "event:" + eventKey} {
+		if strings.HasSuffix(key, ":") {
+			continue
+		}
+		if f.seen[key] {
+			return false, nil
+		}
+		f.seen[key] = true
+	}
+	f.enqueued = append(f.enqueued, payload)
+	return true, nil
+}
+
+func (f *fakeRepository) ClaimWebHooks(ctx context.Context, limit int, lease time.Duration) ([]models.InboxItem, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) CompleteWebHook(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.completed[id] = true
+	return nil
+}
+
+func (f *fakeRepository) RetryWebHook(ctx context.Context, id int64, retryAt time.Time, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retries[id] = retryAt
+	return nil
+}
+
+func (f *fakeRepository) BuryWebHook(ctx context.Context, id int64, reason string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buried[id] = true
+	return nil
+}
+
+func (f *fakeRepository) GetChatIDByTodoist(ctx context.Context, todoistUserID string) (int64, error) {
+	return testChatID, nil
+}
+
+func (f *fakeRepository) RevertTaskTracked(ctx context.Context, chatID int64, taskID string) (models.TaskShow, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	latest := -1
+	for i, t := range f.tracked {
+		if t.TaskID != taskID || t.CompletedAt == nil {
+			continue
+		}
+		if latest < 0 || !t.CompletedAt.Before(*f.tracked[latest].CompletedAt) {
+			latest = i
+		}
+	}
+	if latest < 0 || f.reverted[f.tracked[latest].EventKey] {
+		return models.TaskShow{}, false, nil
+	}
+	t := f.tracked[latest]
+	f.reverted[t.EventKey] = true
+	return models.TaskShow{Task: t.Task, TimeSpent: int64(t.TimeSpent)}, true, nil
+}
+
+func (f *fakeRepository) StoreTaskTracked(ctx context.Context, chatID int64, task models.WebHookParsed) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.storeErr != nil {
+		return false, f.storeErr
+	}
+	for _, t := range f.tracked {
+		if task.EventKey != "" && t.EventKey == task.EventKey {
+			return false, nil
+		}
+	}
+	f.tracked = append(f.tracked, task)
+	return true, nil
+}
+
+const testClientSecret = "test-client-secret"
+
+func signBody(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testClientSecret))
+	mac.Write(body)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
 func createWebhookRequest(eventName string, userID string, task models.Task) *models.WebHookRequest {
 	taskData, _ := json.Marshal(task)
 	return &models.WebHookRequest{
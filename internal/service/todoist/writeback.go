@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"example.com/bot/internal/logger"
+	"example.com/bot/internal/models"
+	"example.com/bot/pkg/duration"
+	"example.com/bot/pkg/todoist"
+	"go.uber.org/zap"
+)
+
+const writeBackTimeout = 30 * time.Second
+
+// SettingsRepository gives the chat preferences.
+type SettingsRepository interface {
+	GetChatSettings(ctx context.Context, chatID int64) (models.ChatSettings, error)
+}
+
+// TrackedWriter is told about every task whose time was stored.
+type TrackedWriter interface {
+	WriteBack(ctx context.Context, wp models.WebHookParsed)
+}
+
+// TimeWriter makes tracked time visible in Todoist for chats that enabled /writeback,
+// with a comment on the task and, if asked, the task's duration.
+type TimeWriter struct {
+	r      SettingsRepository
+	tokens TokenStorage
+	client *todoist.Client
+
+	pending sync.WaitGroup
+}
+
+func NewTimeWriter(r SettingsRepository, tokens TokenStorage, client *todoist.Client) *TimeWriter {
+	return &TimeWriter{
+		r:      r,
+		tokens: tokens,
+		client: client,
+	}
+}
+
+// WriteBack writes the time tracked in wp to the task in the background, so a slow or
+// rate limited Todoist does not hold up the caller, such as the inbox worker. The time
+// is already stored, so failures are only logged.
+func (tw *TimeWriter) WriteBack(ctx context.Context, wp models.WebHookParsed) {
+	// the write outlives the event that caused it
+	ctx = context.WithoutCancel(ctx)
+	tw.pending.Add(1)
+	go func() {
+		defer tw.pending.Done()
+		if err := tw.writeBack(ctx, wp); err != nil {
+			logger.Log.Warn("Error in writing tracked time to todoist",
+				zap.Int64("chat_id", wp.ChatID),
+				zap.String("task_id", wp.TaskID),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+// Wait waits for the writes started by WriteBack to finish.
+func (tw *TimeWriter) Wait() {
+	tw.pending.Wait()
+}
+
+func (tw *TimeWriter) writeBack(ctx context.Context, wp models.WebHookParsed) error {
+	ctx, cancel := context.WithTimeout(ctx, writeBackTimeout)
+	defer cancel()
+	settings, err := tw.r.GetChatSettings(ctx, wp.ChatID)
+	if err != nil {
+		return err
+	}
+	if settings.WriteBack != models.WriteBackComment && settings.WriteBack != models.WriteBackDuration {
+		return nil
+	}
+	token, err := tw.tokens.GetToken(ctx, wp.UserID)
+	if err != nil {
+		return err
+	}
+	comment := fmt.Sprintf("Tracked %s via bot", duration.Format(wp.TimeSpent))
+	if err := tw.client.AddComment(ctx, token, wp.TaskID, comment); err != nil {
+		return err
+	}
+	if settings.WriteBack != models.WriteBackDuration {
+		return nil
+	}
+	return tw.client.UpdateTask(ctx, token, wp.TaskID, todoist.TaskUpdate{
+		Duration:     int(wp.TimeSpent),
+		DurationUnit: "minute",
+	})
+}
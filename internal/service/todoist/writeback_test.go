@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"example.com/bot/internal/models"
+	"example.com/bot/internal/service/todoist/todoisttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeWriter(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         models.WriteBackMode
+		wantComments []todoisttest.Comment
+		wantUpdates  []map[string]any
+	}{
+		{
+			name: "Off",
+			mode: models.WriteBackOff,
+		},
+		{
+			name:         "Comment",
+			mode:         models.WriteBackComment,
+			wantComments: []todoisttest.Comment{{TaskID: "task1", Content: "Tracked 1h30m via bot"}},
+		},
+		{
+			name:         "Comment and duration",
+			mode:         models.WriteBackDuration,
+			wantComments: []todoisttest.Comment{{TaskID: "task1", Content: "Tracked 1h30m via bot"}},
+			wantUpdates:  []map[string]any{{"duration": float64(90), "duration_unit": "minute"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t)
+			fake.AddToken("token")
+			writer := NewTimeWriter(fakeSettings{WriteBack: tt.mode}, &fakeTokens{tokens: map[string]string{"user123": "token"}}, client)
+			updates := make(chan models.WebHookParsed, 1)
+			wh := NewWebHookHandler(updates, testClientSecret, newFakeRepository(), writer, nil)
+
+			err := wh.processWebHook(context.Background(), createWebhookRequest("item:completed", "user123", models.Task{
+				ID:      "task1",
+				Content: "Test Task",
+				Labels:  []string{"log0130"},
+			}))
+			assert.NoError(t, err)
+			select {
+			case <-updates:
+			case <-time.After(time.Second):
+				t.Fatal("Timeout waiting for tracked task notification")
+			}
+			writer.Wait()
+			assert.Equal(t, tt.wantComments, fake.Comments())
+			assert.Equal(t, tt.wantUpdates, fake.TaskUpdates("task1"))
+		})
+	}
+}
+
+type fakeSettings models.ChatSettings
+
+func (f fakeSettings) GetChatSettings(ctx context.Context, chatID int64) (models.ChatSettings, error) {
+	return models.ChatSettings(f), nil
+}
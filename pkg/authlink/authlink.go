@@ -0,0 +1,77 @@
+// Package authlink signs the chat ID carried by /auth links, so an account can only be
+// linked to the chat that asked for the link.
+package authlink
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed = errors.New("malformed auth link token")
+	ErrSignature = errors.New("invalid auth link signature")
+	ErrExpired   = errors.New("auth link expired")
+)
+
+// Signer issues and checks tokens of the form <chat id>.<expiry unix>.<hex HMAC-SHA256>.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// New returns a Signer whose tokens are valid for ttl after they are issued.
+func New(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// Sign returns a token for chatID that expires ttl after now.
+func (s *Signer) Sign(chatID int64, now time.Time) string {
+	payload := strconv.FormatInt(chatID, 10) + "." + strconv.FormatInt(now.Add(s.ttl).Unix(), 10)
+	return payload + "." + hex.EncodeToString(s.mac(payload))
+}
+
+// Verify returns the chat ID of a token produced by Sign with the same secret.
+func (s *Signer) Verify(token string, now time.Time) (int64, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return 0, ErrMalformed
+	}
+	payload, sig := token[:i], token[i+1:]
+	chat, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return 0, ErrMalformed
+	}
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return 0, ErrMalformed
+	}
+	if !hmac.Equal(got, s.mac(payload)) {
+		return 0, ErrSignature
+	}
+	if !now.Before(time.Unix(expiresAt, 0)) {
+		return 0, ErrExpired
+	}
+	return chatID, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,34 @@
+package authlink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	s := New([]byte("secret"), 10*time.Minute)
+
+	token := s.Sign(-100123, now)
+	chatID, err := s.Verify(token, now.Add(9*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-100123), chatID)
+
+	_, err = s.Verify(token, now.Add(10*time.Minute))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	forged := strings.Replace(token, "-100123", "42", 1)
+	_, err = s.Verify(forged, now)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = New([]byte("other"), 10*time.Minute).Verify(token, now)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	for _, malformed := range []string{"", "42", "42.1700000000", "x.1700000000.00", "42.1700000000.zz"} {
+		_, err = s.Verify(malformed, now)
+		assert.ErrorIs(t, err, ErrMalformed, malformed)
+	}
+}
@@ -0,0 +1,106 @@
+// Package duration parses the time amounts users give in Todoist labels and bot replies.
+package duration
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const labelPrefix = "log"
+
+// ErrInvalid is wrapped by every error returned for input that is not a duration.
+var ErrInvalid = errors.New("invalid duration")
+
+var (
+	legacyPattern = regexp.MustCompile(`^(\d{2})(\d{2})$`)
+	minutePattern = regexp.MustCompile(`^\d+$`)
+	clockPattern  = regexp.MustCompile(`^(\d+):(\d{2})$`)
+	unitPattern   = regexp.MustCompile(`^(?:(\d+(?:\.\d+)?)h)?(?:(\d+)m)?$`)
+)
+
+// Parse returns the number of minutes in s. Accepted forms are:
+//
+//	1h30m, 2h, 90m  hours and minutes with units
+//	1.5h            fractional hours, rounded to the minute
+//	1:30            hours and minutes
+//	90              minutes
+//	0205            exactly four digits are hours and minutes (HHMM)
+func Parse(s string) (uint32, error) {
+	in := strings.ToLower(strings.Join(strings.Fields(s), ""))
+	if in == "" {
+		return 0, fmt.Errorf("%w: empty input", ErrInvalid)
+	}
+
+	var minutes float64
+	if m := legacyPattern.FindStringSubmatch(in); m != nil {
+		hours, _ := strconv.ParseFloat(m[1], 64)
+		mins, _ := strconv.ParseFloat(m[2], 64)
+		if mins >= 60 {
+			return 0, fmt.Errorf("%w %q: minutes must be below 60", ErrInvalid, s)
+		}
+		minutes = hours*60 + mins
+	} else if minutePattern.MatchString(in) {
+		minutes, _ = strconv.ParseFloat(in, 64)
+	} else if m := clockPattern.FindStringSubmatch(in); m != nil {
+		hours, _ := strconv.ParseFloat(m[1], 64)
+		mins, _ := strconv.ParseFloat(m[2], 64)
+		if mins >= 60 {
+			return 0, fmt.Errorf("%w %q: minutes must be below 60", ErrInvalid, s)
+		}
+		minutes = hours*60 + mins
+	} else if m := unitPattern.FindStringSubmatch(in); m != nil && (m[1] != "" || m[2] != "") {
+		if strings.Contains(m[1], ".") && m[2] != "" {
+			return 0, fmt.Errorf("%w %q: fractional hours can't be combined with minutes", ErrInvalid, s)
+		}
+		if m[1] != "" {
+			hours, _ := strconv.ParseFloat(m[1], 64)
+			minutes += math.Round(hours * 60)
+		}
+		if m[2] != "" {
+			mins, _ := strconv.ParseFloat(m[2], 64)
+			minutes += mins
+		}
+	} else {
+		return 0, fmt.Errorf("%w %q: use forms like 1h30m, 90m, 1.5h, 1:30 or 90", ErrInvalid, s)
+	}
+
+	if minutes <= 0 {
+		return 0, fmt.Errorf("%w %q: must be at least one minute", ErrInvalid, s)
+	}
+	if minutes > math.MaxUint32 {
+		return 0, fmt.Errorf("%w %q: too long", ErrInvalid, s)
+	}
+	return uint32(minutes), nil
+}
+
+// ParseLabel reads a Todoist label such as "log1h30m". Only labels with a digit after
+// "log" are log labels, so ok is false for labels like "logistics"; err is set for log
+// labels with a malformed duration.
+func ParseLabel(label string) (minutes uint32, ok bool, err error) {
+	rest, found := strings.CutPrefix(strings.ToLower(label), labelPrefix)
+	if !found || rest == "" || rest[0] < '0' || rest[0] > '9' {
+		return 0, false, nil
+	}
+	minutes, err = Parse(rest)
+	if err != nil {
+		return 0, true, err
+	}
+	return minutes, true, nil
+}
+
+// Format writes minutes the way Parse reads them, e.g. "1h30m", "2h" or "45m".
+func Format(minutes uint32) string {
+	h, m := minutes/60, minutes%60
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dh%dm", h, m)
+	}
+}
@@ -0,0 +1,104 @@
+package duration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    uint32
+		wantErr bool
+	}{
+		{input: "1h30m", want: 90},
+		{input: "2h", want: 120},
+		{input: "90m", want: 90},
+		{input: "1.5h", want: 90},
+		{input: "0.25h", want: 15},
+		{input: "1:30", want: 90},
+		{input: "10:05", want: 605},
+		{input: "90", want: 90},
+		{input: "5", want: 5},
+		{input: "0205", want: 125},
+		{input: "1230", want: 750},
+		{input: " 1H 30M ", want: 90},
+		{input: "", wantErr: true},
+		{input: "0", wantErr: true},
+		{input: "0000", wantErr: true},
+		{input: "0h", wantErr: true},
+		{input: "0175", wantErr: true},
+		{input: "1:75", wantErr: true},
+		{input: "1:5", wantErr: true},
+		{input: "1.5h30m", wantErr: true},
+		{input: "1.5m", wantErr: true},
+		{input: "h", wantErr: true},
+		{input: "m", wantErr: true},
+		{input: "30m1h", wantErr: true},
+		{input: "-5", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "99999999999", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLabel(t *testing.T) {
+	tests := []struct {
+		label   string
+		want    uint32
+		wantOK  bool
+		wantErr bool
+	}{
+		{label: "log0205", want: 125, wantOK: true},
+		{label: "log1h30m", want: 90, wantOK: true},
+		{label: "log90m", want: 90, wantOK: true},
+		{label: "log1.5h", want: 90, wantOK: true},
+		{label: "Log2h", want: 120, wantOK: true},
+		{label: "log1x", wantOK: true, wantErr: true},
+		{label: "log0", wantOK: true, wantErr: true},
+		{label: "logbook", wantOK: false},
+		{label: "logistics", wantOK: false},
+		{label: "login-bug", wantOK: false},
+		{label: "log", wantOK: false},
+		{label: "track", wantOK: false},
+		{label: "unrelated-label", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			got, ok, err := ParseLabel(tt.label)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "0m", Format(0))
+	assert.Equal(t, "45m", Format(45))
+	assert.Equal(t, "2h", Format(120))
+	assert.Equal(t, "1h30m", Format(90))
+
+	for _, minutes := range []uint32{1, 59, 60, 61, 125, 1440} {
+		parsed, err := Parse(Format(minutes))
+		assert.NoError(t, err)
+		assert.Equal(t, minutes, parsed)
+	}
+}
@@ -0,0 +1,41 @@
+package secretbox
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBox(t *testing.T) {
+	box, err := New(bytes.Repeat([]byte{1}, KeySize))
+	assert.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("access-token"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "access-token")
+
+	again, err := box.Seal([]byte("access-token"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, sealed, again, "nonce must differ between seals")
+
+	opened, err := box.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "access-token", string(opened))
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	_, err = box.Open(tampered)
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	_, err = box.Open(sealed[:4])
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	other, err := New(bytes.Repeat([]byte{2}, KeySize))
+	assert.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	_, err = New([]byte("short"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,395 @@
+// Package todoist is a client for the parts of the Todoist API used by the bot.
+package todoist
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTokenURL = "https://todoist.com/oauth/access_token"
+	DefaultAPIURL   = "https://api.todoist.com/api/v1"
+
+	defaultMaxRetries = 3
+	defaultRetryBase  = 500 * time.Millisecond
+	defaultRetryMax   = 30 * time.Second
+	// Todoist allows 1000 requests per user in 15 minutes.
+	defaultRateInterval = 900 * time.Millisecond
+	defaultRateBurst    = 50
+	maxErrorBody        = 1 << 10
+	timeLayout          = "2006-01-02T15:04:05Z"
+	// requestIDHeader makes Todoist apply a write only once, however often it is sent.
+	requestIDHeader = "X-Request-Id"
+)
+
+// APIError is returned for responses with a non-2xx status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("todoist: status %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether the request may succeed if sent again later.
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// TokenURL is the OAuth token exchange endpoint, DefaultTokenURL if empty.
+	TokenURL string
+	// APIURL is the base of the API, DefaultAPIURL if empty.
+	APIURL string
+	// HTTPClient is used for requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Client talks to Todoist on behalf of the users whose tokens are passed to its methods.
+// Requests failing with 429 or 5xx are retried with backoff, and requests of each token
+// are rate limited to stay within the Todoist limits. Retries of a write carry the same
+// request ID, so a write that reached Todoist before failing is not applied twice.
+type Client struct {
+	cfg     Config
+	limiter *limiter
+
+	maxRetries int
+	retryBase  time.Duration
+	retryMax   time.Duration
+}
+
+func New(cfg Config) *Client {
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = DefaultTokenURL
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	return &Client{
+		cfg:        cfg,
+		limiter:    newLimiter(defaultRateInterval, defaultRateBurst),
+		maxRetries: defaultMaxRetries,
+		retryBase:  defaultRetryBase,
+		retryMax:   defaultRetryMax,
+	}
+}
+
+// ExchangeToken trades the code from the OAuth callback for an access token.
+func (c *Client) ExchangeToken(ctx context.Context, code string) (Token, error) {
+	form := url.Values{
+		"client_id":     {c.cfg.ClientID},
+		"client_secret": {c.cfg.ClientSecret},
+		"code":          {code},
+	}
+	token := Token{}
+	err := c.do(ctx, "", http.MethodPost, c.cfg.TokenURL, "application/x-www-form-urlencoded", []byte(form.Encode()), &token)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.AccessToken == "" {
+		return Token{}, fmt.Errorf("todoist: token exchange returned no token")
+	}
+	return token, nil
+}
+
+// RevokeToken invalidates the access token.
+func (c *Client) RevokeToken(ctx context.Context, token string) error {
+	params := url.Values{
+		"client_id":     {c.cfg.ClientID},
+		"client_secret": {c.cfg.ClientSecret},
+		"access_token":  {token},
+	}
+	return c.do(ctx, "", http.MethodDelete, c.cfg.APIURL+"/access_tokens?"+params.Encode(), "", nil, nil)
+}
+
+// Sync returns the resources of the given types changed since syncToken, or all of them
+// if syncToken is "*". The response carries the token for the next call.
+func (c *Client) Sync(ctx context.Context, token, syncToken string, resourceTypes ...string) (SyncResponse, error) {
+	types, err := json.Marshal(resourceTypes)
+	if err != nil {
+		return SyncResponse{}, err
+	}
+	form := url.Values{
+		"sync_token":     {syncToken},
+		"resource_types": {string(types)},
+	}
+	resp := SyncResponse{}
+	err = c.do(ctx, token, http.MethodPost, c.cfg.APIURL+"/sync", "application/x-www-form-urlencoded", []byte(form.Encode()), &resp)
+	return resp, err
+}
+
+// GetUser returns the profile of the token's owner.
+func (c *Client) GetUser(ctx context.Context, token string) (User, error) {
+	resp, err := c.Sync(ctx, token, "*", "user")
+	if err != nil {
+		return User{}, err
+	}
+	if resp.User.ID == "" {
+		return User{}, fmt.Errorf("todoist: sync returned no user")
+	}
+	return resp.User, nil
+}
+
+// GetTask returns an active task.
+func (c *Client) GetTask(ctx context.Context, token, taskID string) (Task, error) {
+	task := Task{}
+	err := c.do(ctx, token, http.MethodGet, c.cfg.APIURL+"/tasks/"+url.PathEscape(taskID), "", nil, &task)
+	return task, err
+}
+
+// QuickAdd creates a task from text the way the Todoist quick add bar does, parsing
+// dates, #project, @label and p1-p4 out of it.
+func (c *Client) QuickAdd(ctx context.Context, token, text string) (Task, error) {
+	body, err := json.Marshal(map[string]string{
+		"text": text,
+	})
+	if err != nil {
+		return Task{}, err
+	}
+	task := Task{}
+	err = c.do(ctx, token, http.MethodPost, c.cfg.APIURL+"/tasks/quick", "application/json", body, &task)
+	return task, err
+}
+
+// FilterTasks returns the active tasks matching a Todoist filter query such as "today".
+func (c *Client) FilterTasks(ctx context.Context, token, query string) ([]Task, error) {
+	tasks := make([]Task, 0)
+	cursor := ""
+	for {
+		params := url.Values{"query": {query}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		page := struct {
+			Results    []Task  `json:"results"`
+			NextCursor *string `json:"next_cursor"`
+		}{}
+		if err := c.do(ctx, token, http.MethodGet, c.cfg.APIURL+"/tasks/filter?"+params.Encode(), "", nil, &page); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, page.Results...)
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			return tasks, nil
+		}
+		cursor = *page.NextCursor
+	}
+}
+
+// CloseTask completes the task.
+func (c *Client) CloseTask(ctx context.Context, token, taskID string) error {
+	return c.do(ctx, token, http.MethodPost, c.cfg.APIURL+"/tasks/"+url.PathEscape(taskID)+"/close", "", nil, nil)
+}
+
+// GetProject returns a project of the token's owner.
+func (c *Client) GetProject(ctx context.Context, token, projectID string) (Project, error) {
+	project := Project{}
+	err := c.do(ctx, token, http.MethodGet, c.cfg.APIURL+"/projects/"+url.PathEscape(projectID), "", nil, &project)
+	return project, err
+}
+
+// GetProjects returns all projects of the token's owner.
+func (c *Client) GetProjects(ctx context.Context, token string) ([]Project, error) {
+	projects := make([]Project, 0)
+	cursor := ""
+	for {
+		link := c.cfg.APIURL + "/projects"
+		if cursor != "" {
+			link += "?" + url.Values{"cursor": {cursor}}.Encode()
+		}
+		page := struct {
+			Results    []Project `json:"results"`
+			NextCursor *string   `json:"next_cursor"`
+		}{}
+		if err := c.do(ctx, token, http.MethodGet, link, "", nil, &page); err != nil {
+			return nil, err
+		}
+		projects = append(projects, page.Results...)
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			return projects, nil
+		}
+		cursor = *page.NextCursor
+	}
+}
+
+// GetCompletedTasks returns the tasks completed in [since, until).
+func (c *Client) GetCompletedTasks(ctx context.Context, token string, since, until time.Time) ([]Task, error) {
+	tasks := make([]Task, 0)
+	cursor := ""
+	for {
+		params := url.Values{
+			"since": {since.UTC().Format(timeLayout)},
+			"until": {until.UTC().Format(timeLayout)},
+			"limit": {"200"},
+		}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		page := struct {
+			Items      []Task  `json:"items"`
+			NextCursor *string `json:"next_cursor"`
+		}{}
+		err := c.do(ctx, token, http.MethodGet, c.cfg.APIURL+"/tasks/completed/by_completion_date?"+params.Encode(), "", nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, page.Items...)
+		if page.NextCursor == nil || *page.NextCursor == "" {
+			return tasks, nil
+		}
+		cursor = *page.NextCursor
+	}
+}
+
+// AddComment adds a comment to the task.
+func (c *Client) AddComment(ctx context.Context, token, taskID, content string) error {
+	body, err := json.Marshal(map[string]string{
+		"task_id": taskID,
+		"content": content,
+	})
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, token, http.MethodPost, c.cfg.APIURL+"/comments", "application/json", body, nil)
+}
+
+// TaskUpdate holds the task fields to change. Unset fields are left as they are.
+type TaskUpdate struct {
+	Content *string  `json:"content,omitempty"`
+	Labels  []string `json:"labels,omitempty"`
+	// Duration is set together with DurationUnit, which is "minute" or "day".
+	Duration     int    `json:"duration,omitempty"`
+	DurationUnit string `json:"duration_unit,omitempty"`
+}
+
+// UpdateTask changes the fields of the task set in update.
+func (c *Client) UpdateTask(ctx context.Context, token, taskID string, update TaskUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, token, http.MethodPost, c.cfg.APIURL+"/tasks/"+url.PathEscape(taskID), "application/json", body, nil)
+}
+
+// do sends the request, retrying on 429 and 5xx, and decodes the response into out
+// unless it is nil. An empty token sends an unauthenticated request without rate limiting.
+func (c *Client) do(ctx context.Context, token, method, link, contentType string, body []byte, out any) error {
+	requestID := ""
+	if method != http.MethodGet {
+		var err error
+		if requestID, err = newRequestID(); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if token != "" {
+			if err := c.limiter.wait(ctx, token); err != nil {
+				return err
+			}
+		}
+		retryAfter, err := c.send(ctx, token, method, link, contentType, requestID, body, out)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() || attempt >= c.maxRetries {
+			return err
+		}
+		delay := c.retryDelay(attempt)
+		if retryAfter > 0 {
+			delay = min(retryAfter, c.retryMax)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send performs a single request. retryAfter is the wait asked for by the server, if any.
+func (c *Client) send(ctx context.Context, token, method, link, contentType, requestID string, body []byte, out any) (retryAfter time.Duration, err error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, link, reader)
+	if err != nil {
+		return 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if requestID != "" {
+		req.Header.Set(requestIDHeader, requestID)
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()), &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(string(msg)),
+		}
+	}
+	if out == nil {
+		return 0, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return 0, fmt.Errorf("todoist: decoding response: %w", err)
+	}
+	return 0, nil
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// retryDelay doubles the wait with every attempt, up to retryMax.
+func (c *Client) retryDelay(attempt int) time.Duration {
+	delay := c.retryBase
+	for i := 0; i < attempt && delay < c.retryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, c.retryMax)
+}
+
+// parseRetryAfter reads a Retry-After value given either in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
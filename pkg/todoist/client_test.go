@@ -0,0 +1,224 @@
+package todoist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	c := New(Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL + "/oauth/access_token",
+		APIURL:       srv.URL + "/api/v1",
+	})
+	c.retryBase = time.Millisecond
+	return c
+}
+
+func TestClient_GetUser(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/sync", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, `["user"]`, r.FormValue("resource_types"))
+		json.NewEncoder(w).Encode(SyncResponse{User: User{ID: "user123", FullName: "Test User"}})
+	})
+
+	user, err := c.GetUser(context.Background(), "token")
+	assert.NoError(t, err)
+	assert.Equal(t, "user123", user.ID)
+}
+
+func TestClient_ExchangeToken(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/oauth/access_token", r.URL.Path)
+		assert.Equal(t, "secret", r.FormValue("client_secret"))
+		if r.FormValue("code") != "good" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(Token{AccessToken: "token", TokenType: "Bearer"})
+	})
+
+	token, err := c.ExchangeToken(context.Background(), "good")
+	assert.NoError(t, err)
+	assert.Equal(t, "token", token.AccessToken)
+
+	_, err = c.ExchangeToken(context.Background(), "bad")
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "bad code", apiErr.Body)
+}
+
+func TestClient_retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int32
+		wantStatus   int
+	}{
+		{
+			name:         "Server error is retried",
+			statuses:     []int{http.StatusBadGateway, http.StatusOK},
+			wantRequests: 2,
+		},
+		{
+			name:         "Rate limited request is retried",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+			wantRequests: 3,
+		},
+		{
+			name:         "Client error is not retried",
+			statuses:     []int{http.StatusNotFound, http.StatusOK},
+			wantRequests: 1,
+			wantStatus:   http.StatusNotFound,
+		},
+		{
+			name:         "Gives up after max retries",
+			statuses:     []int{500, 500, 500, 500, 500},
+			wantRequests: defaultMaxRetries + 1,
+			wantStatus:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[requests.Add(1)-1]
+				if status == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "0")
+				}
+				if status != http.StatusOK {
+					w.WriteHeader(status)
+					return
+				}
+				json.NewEncoder(w).Encode(Task{ID: "task1"})
+			})
+
+			task, err := c.GetTask(context.Background(), "token", "task1")
+			assert.Equal(t, tt.wantRequests, requests.Load())
+			if tt.wantStatus == 0 {
+				assert.NoError(t, err)
+				assert.Equal(t, "task1", task.ID)
+				return
+			}
+			var apiErr *APIError
+			assert.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.wantStatus, apiErr.StatusCode)
+		})
+	}
+}
+
+func TestClient_retriedWriteKeepsRequestID(t *testing.T) {
+	var ids []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(requestIDHeader))
+		if len(ids) == 1 {
+			// the task may be created before the response fails
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(Task{ID: "task1"})
+	})
+
+	_, err := c.QuickAdd(context.Background(), "token", "Write report")
+	assert.NoError(t, err)
+	if assert.Len(t, ids, 2) {
+		assert.NotEmpty(t, ids[0])
+		assert.Equal(t, ids[0], ids[1])
+	}
+
+	_, err = c.QuickAdd(context.Background(), "token", "Write report")
+	assert.NoError(t, err)
+	if assert.Len(t, ids, 3) {
+		assert.NotEqual(t, ids[0], ids[2], "another call must get its own request ID")
+	}
+}
+
+func TestClient_retryStopsOnCancel(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := c.AddComment(ctx, "token", "task1", "Tracked 1h")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestClient_GetProjects(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			w.Write([]byte(`{"results":[{"id":"1","name":"Inbox"}],"next_cursor":"page2"}`))
+			return
+		}
+		w.Write([]byte(`{"results":[{"id":"2","name":"Work"}],"next_cursor":null}`))
+	})
+
+	projects, err := c.GetProjects(context.Background(), "token")
+	assert.NoError(t, err)
+	assert.Equal(t, []Project{{ID: "1", Name: "Inbox"}, {ID: "2", Name: "Work"}}, projects)
+}
+
+func TestClient_UpdateTask(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/tasks/task1", r.URL.Path)
+		body := map[string]any{}
+		json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, map[string]any{"duration": float64(90), "duration_unit": "minute"}, body)
+		w.Write([]byte(`{}`))
+	})
+
+	err := c.UpdateTask(context.Background(), "token", "task1", TaskUpdate{Duration: 90, DurationUnit: "minute"})
+	assert.NoError(t, err)
+}
+
+func TestTask_duration(t *testing.T) {
+	task := Task{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":"task1","duration":null}`), &task))
+	assert.Nil(t, task.Duration)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":"task1","duration":{"amount":90,"unit":"minute"}}`), &task))
+	assert.Equal(t, &Duration{Amount: 90, Unit: "minute"}, task.Duration)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	l := newLimiter(time.Second, 3)
+	l.now = func() time.Time { return now }
+
+	for range 3 {
+		assert.Equal(t, time.Duration(0), l.reserve("a"))
+	}
+	assert.Equal(t, time.Second, l.reserve("a"))
+	assert.Equal(t, 2*time.Second, l.reserve("a"))
+	assert.Equal(t, time.Duration(0), l.reserve("b"), "tokens are limited separately")
+
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, time.Duration(0), l.reserve("a"))
+	assert.NotContains(t, l.next, "b", "idle tokens are forgotten")
+	assert.Contains(t, l.next, "a")
+}
@@ -0,0 +1,73 @@
+package todoist
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter spaces out requests per key, allowing up to burst requests at once and one
+// more every interval after that. Keys that have their full burst again are forgotten,
+// so tokens that are no longer used do not stay in memory.
+type limiter struct {
+	interval time.Duration
+	burst    int
+
+	mu        sync.Mutex
+	next      map[string]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func newLimiter(interval time.Duration, burst int) *limiter {
+	return &limiter{
+		interval: interval,
+		burst:    burst,
+		next:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// reserve books a slot for key and returns how long to wait for it.
+func (l *limiter) reserve(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	earliest := now.Add(-time.Duration(l.burst-1) * l.interval)
+	l.prune(now, earliest)
+	at := l.next[key]
+	if at.Before(earliest) {
+		at = earliest
+	}
+	l.next[key] = at.Add(l.interval)
+	return max(at.Sub(now), 0)
+}
+
+// prune drops the keys whose next slot is no later than earliest, as they would be
+// treated like unseen keys anyway. It scans the keys at most once per burst window.
+func (l *limiter) prune(now, earliest time.Time) {
+	if now.Sub(l.lastPrune) < time.Duration(l.burst)*l.interval {
+		return
+	}
+	l.lastPrune = now
+	for key, next := range l.next {
+		if !next.After(earliest) {
+			delete(l.next, key)
+		}
+	}
+}
+
+func (l *limiter) wait(ctx context.Context, key string) error {
+	delay := l.reserve(key)
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -1 +1 @@
-INSERT INTO chat_to_todoist (chat_id, todoist_id) VALUES ($1, $2);
\ No newline at end of file
+INSERT INTO chat_to_todoist (chat_id, todoist_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;
\ No newline at end of file
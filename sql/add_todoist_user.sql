@@ -1 +1,2 @@
-INSERT INTO todoist_users (id, name) VALUES ($1, $2);
\ No newline at end of file
+INSERT INTO todoist_users (id, name, start_day, timezone) VALUES ($1, $2, $3, NULLIF($4, ''))
+ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, start_day = EXCLUDED.start_day, timezone = EXCLUDED.timezone;
\ No newline at end of file
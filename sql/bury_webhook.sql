@@ -0,0 +1 @@
+UPDATE webhook_inbox SET status = 'dead', processed_at = now(), last_error = $2 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,13 @@
+WITH claimed AS (
+    UPDATE webhook_inbox
+    SET attempts = attempts + 1, next_attempt_at = now() + $2 * interval '1 second'
+    WHERE id IN (
+        SELECT id FROM webhook_inbox
+        WHERE status = 'pending' AND next_attempt_at <= now()
+        ORDER BY id
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING id, payload, attempts
+)
+SELECT id, payload, attempts FROM claimed ORDER BY id;
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE webhook_inbox SET status = 'done', processed_at = now(), last_error = NULL WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM timers WHERE chat_id = $1 AND started_at = $2;
\ No newline at end of file
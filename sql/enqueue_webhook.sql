@@ -0,0 +1 @@
+INSERT INTO webhook_inbox (payload, delivery_id, event_key) VALUES ($1::jsonb, NULLIF($2, ''), NULLIF($3, '')) ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -1 +1 @@
-SELECT chat_id FROM chat_to_todoist WHERE todoist_id = $1;
\ No newline at end of file
+SELECT chat_id FROM chat_to_todoist WHERE todoist_id = $1 ORDER BY chat_id LIMIT 1;
\ No newline at end of file
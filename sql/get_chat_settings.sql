@@ -0,0 +1,6 @@
+SELECT COALESCE(u.start_day, 1), COALESCE(ch.timezone, u.timezone, ''), ch.writeback
+FROM chats ch
+LEFT JOIN chat_to_todoist c ON c.chat_id = ch.id
+LEFT JOIN todoist_users u ON u.id = c.todoist_id
+WHERE ch.id = $1
+LIMIT 1;
\ No newline at end of file
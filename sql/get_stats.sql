@@ -1,4 +1,8 @@
-SELECT s.time_count, t.content, t.time_spent
-FROM stat s
-JOIN tasks t ON s.chat_id = t.chat_id
-WHERE s.chat_id = $1;
\ No newline at end of file
+SELECT SUM(SUM(t.time_spent)) OVER (), t.content, SUM(t.time_spent)
+FROM tasks t
+WHERE t.chat_id = $1
+  AND NOT t.reverted
+  AND ($2::timestamptz IS NULL OR t.tracked_at >= $2)
+  AND ($3::timestamptz IS NULL OR t.tracked_at < $3)
+GROUP BY t.content
+ORDER BY 3 DESC;
\ No newline at end of file
@@ -0,0 +1,11 @@
+SELECT COALESCE(l.label, 'No label'), SUM(t.time_spent)
+FROM tasks t
+LEFT JOIN LATERAL unnest(ARRAY(
+    SELECT label FROM unnest(t.labels) AS label WHERE NOT (label = ANY($4::text[])) AND label !~* '^log[0-9]'
+)) AS l(label) ON true
+WHERE t.chat_id = $1
+  AND NOT t.reverted
+  AND ($2::timestamptz IS NULL OR t.tracked_at >= $2)
+  AND ($3::timestamptz IS NULL OR t.tracked_at < $3)
+GROUP BY 1
+ORDER BY 2 DESC;
\ No newline at end of file
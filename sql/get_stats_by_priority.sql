@@ -0,0 +1,8 @@
+SELECT COALESCE('p' || (5 - t.priority), 'No priority'), SUM(t.time_spent)
+FROM tasks t
+WHERE t.chat_id = $1
+  AND NOT t.reverted
+  AND ($2::timestamptz IS NULL OR t.tracked_at >= $2)
+  AND ($3::timestamptz IS NULL OR t.tracked_at < $3)
+GROUP BY 1
+ORDER BY MAX(t.priority) DESC NULLS LAST;
\ No newline at end of file
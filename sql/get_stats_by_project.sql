@@ -0,0 +1,9 @@
+SELECT COALESCE(p.name, t.project_id, 'No project'), SUM(t.time_spent)
+FROM tasks t
+LEFT JOIN projects p ON p.id = t.project_id
+WHERE t.chat_id = $1
+  AND NOT t.reverted
+  AND ($2::timestamptz IS NULL OR t.tracked_at >= $2)
+  AND ($3::timestamptz IS NULL OR t.tracked_at < $3)
+GROUP BY 1
+ORDER BY 2 DESC;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT COALESCE(sync_token, '') FROM todoist_users WHERE id = $1;
\ No newline at end of file
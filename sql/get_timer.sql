@@ -0,0 +1,2 @@
+SELECT COALESCE(task_id, ''), content, COALESCE(project_id, ''), COALESCE(section_id, ''), labels, COALESCE(priority, 0), started_at
+FROM timers WHERE chat_id = $1;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT todoist_id FROM chat_to_todoist WHERE chat_id = $1 LIMIT 1;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT id FROM todoist_users;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT token FROM todoist_tokens WHERE todoist_id = $1;
\ No newline at end of file
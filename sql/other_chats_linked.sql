@@ -0,0 +1 @@
+SELECT EXISTS (SELECT 1 FROM chat_to_todoist WHERE todoist_id = $2 AND chat_id <> $1);
\ No newline at end of file
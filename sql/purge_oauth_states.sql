@@ -0,0 +1 @@
+DELETE FROM oauth_states WHERE expires_at <= now();
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE webhook_inbox SET next_attempt_at = $2, last_error = $3 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT revertedContent, revertedTime FROM RevertStats($1, $2);
\ No newline at end of file
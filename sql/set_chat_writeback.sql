@@ -0,0 +1 @@
+UPDATE chats SET writeback = $2 WHERE id = $1;
\ No newline at end of file
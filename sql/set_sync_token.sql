@@ -0,0 +1 @@
+UPDATE todoist_users SET sync_token = $2 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO timers (chat_id, task_id, content, project_id, section_id, labels, priority, started_at)
+VALUES ($1, NULLIF($2, ''), $3, NULLIF($4, ''), NULLIF($5, ''), COALESCE($6::TEXT[], '{}'), NULLIF($7, 0), $8)
+ON CONFLICT (chat_id) DO NOTHING;
\ No newline at end of file
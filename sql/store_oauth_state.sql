@@ -0,0 +1 @@
+INSERT INTO oauth_states (state, chat_id, expires_at) VALUES ($1, $2, now() + $3 * interval '1 second');
\ No newline at end of file
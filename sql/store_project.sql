@@ -0,0 +1,2 @@
+INSERT INTO projects (id, todoist_id, name) VALUES ($1, $2, $3)
+ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, todoist_id = EXCLUDED.todoist_id;
\ No newline at end of file
@@ -1 +1 @@
-CALL RecordStats($1, $2, $3);
\ No newline at end of file
+SELECT RecordStats($1, NULLIF($2, ''), $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8, NULLIF($9, 0), $10);
\ No newline at end of file
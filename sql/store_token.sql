@@ -0,0 +1,2 @@
+INSERT INTO todoist_tokens (todoist_id, token) VALUES ($1, $2)
+ON CONFLICT (todoist_id) DO UPDATE SET token = EXCLUDED.token, updated_at = now();
\ No newline at end of file
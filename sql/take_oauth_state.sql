@@ -0,0 +1 @@
+DELETE FROM oauth_states WHERE state = $1 RETURNING chat_id, expires_at <= now();
\ No newline at end of file
@@ -0,0 +1,11 @@
+WITH unlinked AS (
+    DELETE FROM chat_to_todoist WHERE chat_id = $1
+), last_link AS (
+    -- the statement sees the links as they were before the delete above
+    SELECT NOT EXISTS (
+        SELECT 1 FROM chat_to_todoist WHERE todoist_id = $2 AND chat_id <> $1
+    ) AS last
+), reset AS (
+    UPDATE todoist_users SET sync_token = NULL WHERE id = $2 AND (SELECT last FROM last_link)
+)
+DELETE FROM todoist_tokens WHERE todoist_id = $2 AND (SELECT last FROM last_link);
\ No newline at end of file